@@ -0,0 +1,90 @@
+package boomer
+
+import (
+	"fmt"
+	"time"
+)
+
+// abortGuard watches the failure ratio and p95 of the reports in a rolling window,
+// so a failing target isn't hammered until someone stops the test.
+type abortGuard struct {
+	failureRatio float64
+	p95          time.Duration
+	window       time.Duration
+
+	startTime time.Time
+	intervals []abortInterval
+}
+
+// abortInterval is the total of a report.
+type abortInterval struct {
+	time      time.Time
+	requests  int64
+	failures  int64
+	histogram *histogram
+}
+
+// newAbortGuard returns nil if neither limit is set.
+func newAbortGuard(failureRatio float64, p95 time.Duration, window time.Duration) *abortGuard {
+	if failureRatio <= 0 && p95 <= 0 {
+		return nil
+	}
+	return &abortGuard{
+		failureRatio: failureRatio,
+		p95:          p95,
+		window:       window,
+		startTime:    time.Now(),
+	}
+}
+
+// reset forgets the reports, it's called when users start hatching.
+func (g *abortGuard) reset() {
+	g.startTime = time.Now()
+	g.intervals = nil
+}
+
+// check adds a report to the window and returns why users should be stopped, or "" if they shouldn't.
+// Limits are checked only when the window is filled, so a few early failures don't abort the test.
+func (g *abortGuard) check(data map[string]interface{}) string {
+	now := time.Now()
+	total, _ := data["stats_total"].(map[string]interface{})
+	h, _ := total["histogram"].(*histogram)
+	g.intervals = append(g.intervals, abortInterval{
+		time:      now,
+		requests:  toInt64(total["num_requests"]),
+		failures:  toInt64(total["num_failures"]),
+		histogram: h,
+	})
+	for len(g.intervals) > 0 && now.Sub(g.intervals[0].time) >= g.window {
+		g.intervals = g.intervals[1:]
+	}
+	if now.Sub(g.startTime) < g.window {
+		return ""
+	}
+
+	var requests, failures int64
+	var merged *histogram
+	for _, interval := range g.intervals {
+		requests += interval.requests
+		failures += interval.failures
+		if interval.histogram == nil {
+			continue
+		}
+		if merged == nil {
+			merged = newHistogram(interval.histogram.unit)
+		}
+		merged.merge(interval.histogram)
+	}
+
+	if g.failureRatio > 0 && requests+failures > 0 {
+		if ratio := float64(failures) / float64(requests+failures); ratio > g.failureRatio {
+			return fmt.Sprintf("failure ratio %.2f%% in the last %v exceeds %.2f%%", ratio*100, g.window, g.failureRatio*100)
+		}
+	}
+	if g.p95 > 0 && merged != nil {
+		if p95 := merged.percentile(95); p95 > g.p95 {
+			return fmt.Sprintf("p95 %v in the last %v exceeds %v", p95, g.window, g.p95)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,115 @@
+package boomer
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func abortReport(requests, failures int64, responseTimes map[time.Duration]int64) map[string]interface{} {
+	h := newHistogram(time.Millisecond)
+	for responseTime, count := range responseTimes {
+		for i := int64(0); i < count; i++ {
+			h.record(responseTime)
+		}
+	}
+	return map[string]interface{}{
+		"stats_total": map[string]interface{}{
+			"num_requests": requests,
+			"num_failures": failures,
+			"histogram":    h,
+		},
+	}
+}
+
+func TestAbortGuard(t *testing.T) {
+	if newAbortGuard(0, 0, time.Second) != nil {
+		t.Error("there should be no guard without limits")
+	}
+
+	g := newAbortGuard(0.5, 0, 50*time.Millisecond)
+	if reason := g.check(abortReport(0, 10, nil)); reason != "" {
+		t.Error("limits shouldn't be checked before the window is filled, got", reason)
+	}
+	time.Sleep(60 * time.Millisecond)
+	// failures of the first report are out of the window
+	if reason := g.check(abortReport(10, 5, nil)); reason != "" {
+		t.Error("failure ratio is below the limit, got", reason)
+	}
+	if reason := g.check(abortReport(0, 10, nil)); !strings.HasPrefix(reason, "failure ratio 60.00%") {
+		t.Error("failure ratio should exceed the limit, got", reason)
+	}
+
+	g = newAbortGuard(0, 100*time.Millisecond, time.Nanosecond)
+	if reason := g.check(abortReport(10, 0, map[time.Duration]int64{50 * time.Millisecond: 10})); reason != "" {
+		t.Error("p95 is below the limit, got", reason)
+	}
+	if reason := g.check(abortReport(10, 0, map[time.Duration]int64{50 * time.Millisecond: 5, 200 * time.Millisecond: 5})); !strings.HasPrefix(reason, "p95 200ms") {
+		t.Error("p95 should exceed the limit, got", reason)
+	}
+}
+
+type abortReasonOutput struct {
+	mutex  sync.Mutex
+	reason string
+}
+
+func (o *abortReasonOutput) OnStart() {}
+
+func (o *abortReasonOutput) OnEvent(data map[string]interface{}) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if reason, ok := data["abort_reason"].(string); ok {
+		o.reason = reason
+	}
+}
+
+func (o *abortReasonOutput) OnStop() {}
+
+func (o *abortReasonOutput) getReason() string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.reason
+}
+
+func TestAbort(t *testing.T) {
+	stats := newRequestStats(time.Microsecond)
+	stats.start()
+	defer stats.close()
+	config := DefaultConfig()
+	config.HeartbeatInterval = 0
+	config.AbortFailureRatio = 0.1
+	config.AbortWindow = time.Nanosecond
+	r := newRunner([]*Task{{Name: "foo", Weight: 1, Fn: func() { time.Sleep(time.Millisecond) }}}, stats, config)
+	output := &abortReasonOutput{}
+	r.outputs = []Output{output}
+	r.getReady()
+	defer r.close()
+
+	r.startHatching(1, 1)
+	stats.messageToRunner <- abortReport(1, 1, nil)
+	waitFor(t, time.Second, func() bool { return output.getReason() != "" })
+	if state := r.getState(); state != stateStopped {
+		t.Error("users should be stopped, state is", state)
+	}
+
+	var exception *message
+	for exception == nil {
+		if msg := <-r.toMaster; msg.Type == "exception" {
+			exception = msg
+		}
+	}
+	if !strings.Contains(exception.Data["msg"].(string), output.getReason()) {
+		t.Error("master should be told the reason, got", exception.Data)
+	}
+
+	select {
+	case reason := <-r.abortedChannel:
+		if reason != output.getReason() {
+			t.Error("unexpected reason", reason)
+		}
+	case <-time.After(time.Second):
+		t.Error("abort isn't announced")
+	}
+}
@@ -1,15 +1,363 @@
 package boomer
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
+
+	"github.com/asaskevich/EventBus"
+)
+
+// Config holds the settings of a Boomer.
+type Config struct {
+	// MasterHost and MasterPort is the address of the locust master.
+	MasterHost string
+	MasterPort int
+	// RPC is zeromq or socket, don't mix them up.
+	RPC string
+	// MaxRPS limits the RPS that boomer can generate, 0 means no limit.
+	MaxRPS int64
+	// Standalone runs without a master, NumClients are hatched
+	// at HatchRate per second once Run is called.
+	Standalone bool
+	NumClients int
+	HatchRate  int
+	// HistogramPrecision is the unit of latency histograms, local percentiles
+	// are accurate to 1% of the response time or HistogramPrecision.
+	HistogramPrecision time.Duration
+	// PrometheusListen is the address that metrics are served on for prometheus,
+	// e.g. ":9646". Empty disables the endpoint.
+	PrometheusListen string
+	// CSVPrefix and JSONPrefix write results to files named with the prefixes, empty disables them.
+	// Files are flushed every OutputFlushInterval, and when users are stopped.
+	CSVPrefix           string
+	JSONPrefix          string
+	OutputFlushInterval time.Duration
+	// HTMLReport is the path of a HTML report written when users are stopped, empty disables it.
+	HTMLReport string
+	// Thresholds are checked against the stats since users start hatching when users are stopped,
+	// e.g. "http/200: p99 < 250ms", "failure_ratio < 1%", "rps > 500". See BrokenThresholds.
+	Thresholds []string
+	// ThresholdsContinuous checks upper limits like "p99 < 250ms" at every report too, the package-level Run
+	// quits as soon as one breaks, in standalone mode or connected to a master. Lower limits like "rps > 500"
+	// are only checked when users are stopped.
+	ThresholdsContinuous bool
+	// AbortFailureRatio and AbortP95 stop running users when the failure ratio or p95 of the last AbortWindow
+	// exceed them, 0 disables them. Master is told why, and the standalone run quits.
+	AbortFailureRatio float64
+	AbortP95          time.Duration
+	AbortWindow       time.Duration
+	// StopTimeout is how long stopping waits for running tasks to return, 0 means no wait.
+	StopTimeout time.Duration
+	// RunTime stops running users after they start hatching for so long, 0 means forever.
+	RunTime time.Duration
+	// Iterations limits the iterations of all the users, and IterationsPerUser limits the ones of every user.
+	// Users are stopped when they run out of iterations, 0 means no limit.
+	Iterations        int64
+	IterationsPerUser int64
+	// Executor is ExecutorUsers or ExecutorArrivalRate. With ExecutorArrivalRate, the number of users,
+	// from master or NumClients, is the number of iterations started per second, and HatchRate ramps it every second.
+	// ArrivalDistribution is ArrivalConstant or ArrivalPoisson, and iterations run in at most MaxWorkers goroutines.
+	// MaxRPS and IterationsPerUser don't work with ExecutorArrivalRate.
+	Executor            string
+	ArrivalDistribution string
+	MaxWorkers          int
+	// Protocol is the version of locust master, ProtocolLocust0, ProtocolLocust1 or ProtocolLocust2.
+	// Newer versions require RPC to be zeromq.
+	Protocol string
+	// DisconnectPolicy decides whether running users are stopped
+	// while boomer reconnects to the master.
+	DisconnectPolicy string
+	// HeartbeatInterval is how often boomer sends heartbeats to master, 0 disables heartbeats.
+	HeartbeatInterval time.Duration
+	// MasterHeartbeatTimeout stops running users if master, which has sent
+	// heartbeats before, keeps silent for so long. 0 disables the check.
+	MasterHeartbeatTimeout time.Duration
+}
+
+// Disconnect policies, see Config.DisconnectPolicy.
+const (
+	DisconnectPolicyStop = "stop"
+	DisconnectPolicyKeep = "keep"
 )
 
+// DefaultConfig returns the defaults of boomer's command-line flags.
+func DefaultConfig() Config {
+	return Config{
+		MasterHost: "127.0.0.1",
+		MasterPort: 5557,
+		RPC:        "zeromq",
+		NumClients: 1,
+		HatchRate:  1,
+
+		HistogramPrecision:     time.Microsecond,
+		OutputFlushInterval:    10 * time.Second,
+		AbortWindow:            30 * time.Second,
+		StopTimeout:            10 * time.Second,
+		Executor:               ExecutorUsers,
+		ArrivalDistribution:    ArrivalConstant,
+		MaxWorkers:             1000,
+		Protocol:               ProtocolLocust0,
+		DisconnectPolicy:       DisconnectPolicyStop,
+		HeartbeatInterval:      1 * time.Second,
+		MasterHeartbeatTimeout: 60 * time.Second,
+	}
+}
+
+// RegisterFlags registers command-line flags on fs, parsing fs overrides the values of c.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.MasterHost, "master-host", c.MasterHost, "Host or IP address of locust master for distributed load testing. Defaults to 127.0.0.1.")
+	fs.IntVar(&c.MasterPort, "master-port", c.MasterPort, "The port to connect to that is used by the locust master for distributed load testing. Defaults to 5557.")
+	fs.StringVar(&c.RPC, "rpc", c.RPC, "Choose zeromq or tcp socket to communicate with master, don't mix them up.")
+	fs.Int64Var(&c.MaxRPS, "max-rps", c.MaxRPS, "Max RPS that boomer can generate.")
+	fs.DurationVar(&c.HistogramPrecision, "histogram-precision", c.HistogramPrecision, "Precision of latency histograms, e.g. 1us, 1ms.")
+	fs.StringVar(&c.PrometheusListen, "prometheus-listen", c.PrometheusListen, "Serve metrics for prometheus on the address, e.g. :9646, at /metrics.")
+	fs.StringVar(&c.CSVPrefix, "csv", c.CSVPrefix, "Write results in CSV to PREFIX_stats.csv, PREFIX_stats_history.csv and PREFIX_failures.csv.")
+	fs.StringVar(&c.JSONPrefix, "json", c.JSONPrefix, "Write results in JSON Lines to PREFIX_stats.jsonl, PREFIX_stats_history.jsonl and PREFIX_failures.jsonl.")
+	fs.DurationVar(&c.OutputFlushInterval, "output-flush-interval", c.OutputFlushInterval, "How often result files are flushed.")
+	fs.StringVar(&c.HTMLReport, "html", c.HTMLReport, "Write a HTML report to the file when users are stopped.")
+	fs.Var(thresholdsFlag{&c.Thresholds}, "threshold", "A condition to pass, e.g. 'http/200: p99 < 250ms', 'failure_ratio < 1%', 'rps > 500'. It can be repeated, the process exits with 1 if any breaks.")
+	fs.BoolVar(&c.ThresholdsContinuous, "thresholds-continuous", c.ThresholdsContinuous, "Check upper limits like 'p99 < 250ms' at every report, and quit as soon as one breaks, a worker connected to master quits as well. Lower limits are checked when users are stopped.")
+	fs.Float64Var(&c.AbortFailureRatio, "abort-failure-ratio", c.AbortFailureRatio, "Stop running users if the failure ratio in the abort window exceeds it, e.g. 0.5. 0 disables it.")
+	fs.DurationVar(&c.AbortP95, "abort-p95", c.AbortP95, "Stop running users if the p95 response time in the abort window exceeds it, e.g. 2s. 0 disables it.")
+	fs.DurationVar(&c.AbortWindow, "abort-window", c.AbortWindow, "The rolling window in which the failure ratio and p95 are checked.")
+	fs.DurationVar(&c.StopTimeout, "stop-timeout", c.StopTimeout, "How long stopping waits for running tasks to return, so their results are reported. 0 means no wait.")
+	fs.DurationVar(&c.RunTime, "run-time", c.RunTime, "Stop running users after the specified amount of time since they start hatching, e.g. 300s, 5m, 1h30m. Defaults to run forever.")
+	fs.Int64Var(&c.Iterations, "iterations", c.Iterations, "Stop running users after they run tasks for so many times in total, 0 means no limit.")
+	fs.Int64Var(&c.IterationsPerUser, "iterations-per-user", c.IterationsPerUser, "Every user stops after it runs tasks for so many times, 0 means no limit.")
+	fs.StringVar(&c.Executor, "executor", c.Executor, "Choose users, which run tasks in loops, or arrival-rate, which starts iterations at the rate of the number of users per second.")
+	fs.StringVar(&c.ArrivalDistribution, "arrival-distribution", c.ArrivalDistribution, "Choose constant or poisson intervals of iterations for the arrival-rate executor.")
+	fs.IntVar(&c.MaxWorkers, "max-workers", c.MaxWorkers, "Max goroutines that run iterations for the arrival-rate executor, iterations are dropped if all of them are busy.")
+	fs.StringVar(&c.Protocol, "protocol", c.Protocol, "Version of locust master, choose 0.x, 1.x or 2.x. 1.x and 2.x require zeromq.")
+	fs.StringVar(&c.DisconnectPolicy, "disconnect-policy", c.DisconnectPolicy, "Choose stop or keep running users when the connection to master drops, boomer always reconnects.")
+	fs.DurationVar(&c.HeartbeatInterval, "heartbeat-interval", c.HeartbeatInterval, "How often heartbeats are sent to master, 0 disables heartbeats.")
+	fs.DurationVar(&c.MasterHeartbeatTimeout, "master-heartbeat-timeout", c.MasterHeartbeatTimeout, "Stop running users if master stops sending heartbeats for so long, 0 disables the check.")
+	fs.BoolVar(&c.Standalone, "standalone", c.Standalone, "Run a load test without connecting to the master, stats are printed to the console.")
+	fs.IntVar(&c.NumClients, "clients", c.NumClients, "Number of concurrent clients to spawn in standalone mode.")
+	fs.IntVar(&c.HatchRate, "hatch-rate", c.HatchRate, "The rate per second in which clients are spawned in standalone mode.")
+}
+
+// Boomer is a load generator, several of them can run in one process.
+type Boomer struct {
+	// Events is the event bus of this boomer, tasks publish
+	// request_success and request_failure to it.
+	Events EventBus.Bus
+
+	config                 Config
+	outputs                []Output
+	prometheus             *prometheusOutput
+	thresholds             *thresholdOutput
+	stats                  *requestStats
+	runner                 *runner
+	disconnectedFromMaster chan bool
+}
+
+// New returns a Boomer with its own event bus.
+func New(config Config) *Boomer {
+	return newBoomer(config, EventBus.New())
+}
+
+func newBoomer(config Config, events EventBus.Bus) *Boomer {
+	// stats are collected as soon as a boomer is created, so
+	// requests can be recorded before Run, like --run-tasks does.
+	stats := newRequestStats(config.HistogramPrecision)
+	stats.subscribe(events)
+	stats.start()
+	return &Boomer{
+		Events:                 events,
+		config:                 config,
+		stats:                  stats,
+		disconnectedFromMaster: make(chan bool),
+	}
+}
+
+// validate returns an error if the settings can't work together.
+func (c Config) validate() error {
+	if c.Standalone && (c.NumClients <= 0 || c.HatchRate <= 0) {
+		return fmt.Errorf("invalid arguments for standalone mode, clients is %d, hatch-rate is %d", c.NumClients, c.HatchRate)
+	}
+	protocol, err := newProtocol(c.Protocol)
+	if err != nil {
+		return err
+	}
+	if !c.Standalone && c.RPC != "zeromq" && c.RPC != "socket" {
+		return fmt.Errorf("unknown rpc type: %s", c.RPC)
+	}
+	if !c.Standalone && protocol.dealer() && c.RPC != "zeromq" {
+		return fmt.Errorf("locust %s only supports zeromq", c.Protocol)
+	}
+	if c.DisconnectPolicy != DisconnectPolicyStop && c.DisconnectPolicy != DisconnectPolicyKeep {
+		return fmt.Errorf("unknown disconnect policy: %s", c.DisconnectPolicy)
+	}
+	if (c.AbortFailureRatio > 0 || c.AbortP95 > 0) && c.AbortWindow <= 0 {
+		return fmt.Errorf("invalid abort window: %v", c.AbortWindow)
+	}
+	if c.Executor != ExecutorUsers && c.Executor != ExecutorArrivalRate {
+		return fmt.Errorf("unknown executor: %s", c.Executor)
+	}
+	if c.ArrivalDistribution != ArrivalConstant && c.ArrivalDistribution != ArrivalPoisson {
+		return fmt.Errorf("unknown arrival distribution: %s", c.ArrivalDistribution)
+	}
+	if c.Executor == ExecutorArrivalRate && c.MaxWorkers <= 0 {
+		return fmt.Errorf("invalid max workers for the arrival-rate executor: %d", c.MaxWorkers)
+	}
+	if c.Executor == ExecutorArrivalRate && (c.IterationsPerUser > 0 || c.MaxRPS > 0) {
+		return errors.New("the arrival-rate executor sets the rate by itself and has no users, it doesn't work with max-rps or iterations-per-user")
+	}
+	return nil
+}
+
+// Run connects to the master and waits for it to hatch tasks, in standalone mode,
+// tasks are hatched immediately. Run doesn't block, it returns an error if the config
+// is invalid or an output can't be started, and the boomer can't be used then.
+func (b *Boomer) Run(tasks ...*Task) error {
+	if err := b.config.validate(); err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if task.taskSet != nil && !task.taskSet.hasTasks() {
+			return fmt.Errorf("task set %s has no tasks", task.Name)
+		}
+	}
+	var thresholds *thresholdOutput
+	if len(b.config.Thresholds) > 0 {
+		var err error
+		if thresholds, err = newThresholdOutput(b.config.Thresholds, b.config.ThresholdsContinuous); err != nil {
+			return err
+		}
+	}
+
+	b.runner = newRunner(tasks, b.stats, b.config)
+	// outputs of config are added after the ones of AddOutput
+	outputs := append([]Output(nil), b.outputs...)
+	if b.config.Standalone {
+		// there is no master to show the stats
+		outputs = append(outputs, NewConsoleOutput())
+	}
+	if b.config.CSVPrefix != "" {
+		outputs = append(outputs, NewCSVOutput(b.config.CSVPrefix, b.config.OutputFlushInterval))
+	}
+	if b.config.JSONPrefix != "" {
+		outputs = append(outputs, NewJSONOutput(b.config.JSONPrefix, b.config.OutputFlushInterval))
+	}
+	if b.config.HTMLReport != "" {
+		outputs = append(outputs, NewHTMLOutput(b.config.HTMLReport))
+	}
+	if thresholds != nil {
+		b.thresholds = thresholds
+		outputs = append(outputs, thresholds)
+	}
+	if b.config.PrometheusListen != "" {
+		prometheus := newPrometheusOutput(b.runner.nodeID, b.runner.getState)
+		if err := prometheus.listen(b.config.PrometheusListen); err != nil {
+			return fmt.Errorf("failed to serve metrics for prometheus, %v", err)
+		}
+		b.prometheus = prometheus
+		outputs = append(outputs, prometheus)
+	}
+	b.runner.outputs = outputs
+	if b.config.Standalone {
+		b.runner.client = newLocalClient(b.runner.toMaster, b.disconnectedFromMaster)
+	} else if b.runner.protocol.dealer() {
+		b.runner.client = newDealerClient(b.config.MasterHost, b.config.MasterPort, b.runner.nodeID,
+			b.runner.fromMaster, b.runner.toMaster, b.disconnectedFromMaster)
+	} else {
+		b.runner.client = newClient(b.config.RPC, b.config.MasterHost, b.config.MasterPort,
+			b.runner.fromMaster, b.runner.toMaster, b.disconnectedFromMaster)
+	}
+
+	b.Events.Subscribe("boomer:quit", b.runner.onQuiting)
+
+	b.runner.getReady()
+
+	if b.config.Standalone {
+		b.runner.startHatching(b.config.NumClients, b.config.HatchRate)
+	}
+	return nil
+}
+
+// Finished returns a channel that receives the reason when users reach RunTime or Iterations,
+// call it after Run. With a master, users can be hatched again after they're finished.
+func (b *Boomer) Finished() <-chan string {
+	return b.runner.finishedChannel
+}
+
+// Aborted returns a channel that receives the reason when users are stopped
+// by AbortFailureRatio or AbortP95, call it after Run.
+func (b *Boomer) Aborted() <-chan string {
+	return b.runner.abortedChannel
+}
+
+// setConfig replaces the config, which is parsed from flags after the default boomer is created.
+// Stats are created again if the histogram precision is changed.
+func (b *Boomer) setConfig(config Config) {
+	b.config = config
+	if b.stats.precision == config.HistogramPrecision {
+		return
+	}
+	b.stats.unsubscribe(b.Events)
+	b.stats.close()
+	b.stats = newRequestStats(config.HistogramPrecision)
+	b.stats.subscribe(b.Events)
+	b.stats.start()
+}
+
+// AddOutput adds an Output that receives the reports, it must be called before Run.
+func (b *Boomer) AddOutput(o Output) {
+	b.outputs = append(b.outputs, o)
+}
+
+// BrokenThresholds returns the broken thresholds with their actual values, it's empty if all of them pass.
+// Thresholds are checked when users are stopped, so call it after Stop or Quit.
+func (b *Boomer) BrokenThresholds() []string {
+	if b.thresholds == nil {
+		return nil
+	}
+	return b.thresholds.brokenThresholds()
+}
+
+// thresholdsBroken returns a channel that receives when a threshold breaks during a continuous check.
+func (b *Boomer) thresholdsBroken() <-chan struct{} {
+	if b.thresholds == nil || !b.config.ThresholdsContinuous {
+		return nil
+	}
+	return b.thresholds.brokenChannel
+}
+
+// Stop stops the running tasks and waits for them to return within StopTimeout,
+// the master is told that this boomer is ready again.
+func (b *Boomer) Stop() {
+	b.runner.stop()
+	b.runner.toMaster <- newMessage("client_stopped", nil, b.runner.nodeID)
+	b.runner.toMaster <- b.runner.protocol.clientReady(b.runner.nodeID)
+}
+
+// Quit stops the running tasks, tells the master that this boomer quits
+// and waits until the message is sent.
+func (b *Boomer) Quit() {
+	b.runner.stop()
+	b.Events.Publish("boomer:quit")
+
+	// wait for quit message is sent to master
+	<-b.disconnectedFromMaster
+
+	b.Events.Unsubscribe("boomer:quit", b.runner.onQuiting)
+	b.stats.unsubscribe(b.Events)
+	b.runner.close()
+	b.stats.close()
+	if b.prometheus != nil {
+		b.prometheus.close()
+	}
+}
+
 // Run accepts a slice of Task and connects
 // to a locust master.
 func Run(tasks ...*Task) {
@@ -18,12 +366,14 @@ func Run(tasks ...*Task) {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
 	if !flag.Parsed() {
+		RegisterFlags()
 		flag.Parse()
 	}
+	defaultBoomer.setConfig(defaultConfig)
 
-	if *runTasks != "" {
+	if runTasks != "" {
 		// Run tasks without connecting to the master.
-		taskNames := strings.Split(*runTasks, ",")
+		taskNames := strings.Split(runTasks, ",")
 		for _, task := range tasks {
 			if task.Name == "" {
 				continue
@@ -31,50 +381,91 @@ func Run(tasks ...*Task) {
 				for _, name := range taskNames {
 					if name == task.Name {
 						log.Println("Running " + task.Name)
-						task.Fn()
+						ctx := context.WithValue(context.Background(), statsContextKey{}, defaultBoomer.stats)
+						user := task.newUser()
+						if user != nil {
+							user.OnStart(ctx)
+						}
+						task.run(ctx, user)
+						if user != nil {
+							user.OnStop()
+						}
 					}
 				}
 			}
 		}
+		// show what the tasks have recorded
+		console := NewConsoleOutput()
+		console.entries.extend(defaultBoomer.stats.flush())
+		console.OnStop()
 		return
 	}
 
-	if maxRPS > 0 {
-		log.Println("Max RPS that boomer may generate is limited to", maxRPS)
-		maxRPSEnabled = true
+	b := defaultBoomer
+	if err := b.Run(tasks...); err != nil {
+		log.Fatalln(err)
 	}
 
-	var r *runner
-	client := newClient()
-	r = &runner{
-		tasks:  tasks,
-		client: client,
-		nodeID: getNodeID(),
-	}
-
-	Events.Subscribe("boomer:quit", r.onQuiting)
-
-	r.getReady()
-
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT)
 
-	<-c
-	Events.Publish("boomer:quit")
+	// with a master, users can be hatched again after they're finished or aborted,
+	// a nil channel blocks forever.
+	var finished, aborted <-chan string
+	if defaultConfig.Standalone {
+		finished = b.Finished()
+		aborted = b.Aborted()
+	}
+
+	select {
+	case <-c:
+	case <-finished:
+		log.Println("Users are finished, shutting down...")
+	case <-b.thresholdsBroken():
+		log.Println("Threshold broken, shutting down...")
+	case <-aborted:
+		log.Println("Users are aborted, shutting down...")
+		b.Quit()
+		exitOnBrokenThresholds(b)
+		os.Exit(1)
+	case <-b.runner.quitChannel:
+		// master has quit, no need to say goodbye
+		exitOnBrokenThresholds(b)
+		return
+	}
 
-	// wait for quit message is sent to master
-	<-disconnectedFromMaster
+	b.Quit()
 	log.Println("shut down")
+	exitOnBrokenThresholds(b)
 
 }
 
-var runTasks *string
-var maxRPS int64
-var maxRPSThreshold int64
-var maxRPSEnabled = false
-var maxRPSControlChannel = make(chan bool)
+// exitOnBrokenThresholds fails the process, so CI pipelines can tell a regression.
+func exitOnBrokenThresholds(b *Boomer) {
+	if broken := b.BrokenThresholds(); len(broken) > 0 {
+		log.Printf("%d threshold(s) broken: %s\n", len(broken), strings.Join(broken, "; "))
+		os.Exit(1)
+	}
+}
 
-func init() {
-	runTasks = flag.String("run-tasks", "", "Run tasks without connecting to the master, multiply tasks is separated by comma. Usually, it's for debug purpose.")
-	flag.Int64Var(&maxRPS, "max-rps", 0, "Max RPS that boomer can generate.")
+// AddOutput adds an Output to the default boomer, it must be called before Run.
+func AddOutput(o Output) {
+	defaultBoomer.AddOutput(o)
 }
+
+// RegisterFlags registers boomer's command-line flags on flag.CommandLine.
+// Run calls it if flags are not parsed yet, if your program parses flags
+// before calling Run, call RegisterFlags before flag.Parse.
+func RegisterFlags() {
+	if flagsRegistered {
+		return
+	}
+	flagsRegistered = true
+	defaultConfig.RegisterFlags(flag.CommandLine)
+	flag.StringVar(&runTasks, "run-tasks", "", "Run tasks without connecting to the master, multiply tasks is separated by comma. Usually, it's for debug purpose.")
+}
+
+var defaultConfig = DefaultConfig()
+var defaultBoomer = newBoomer(defaultConfig, Events)
+var flagsRegistered = false
+var runTasks string
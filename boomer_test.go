@@ -0,0 +1,183 @@
+package boomer
+
+import (
+	"flag"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asaskevich/EventBus"
+	"github.com/myzhan/boomer/master"
+)
+
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout")
+}
+
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestBoomersAreIndependent(t *testing.T) {
+	port := freePort(t)
+	m := master.New("127.0.0.1", port, "socket")
+	if err := m.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.MasterPort = port
+	config.RPC = "socket"
+
+	boomers := make([]*Boomer, 2)
+	for i := range boomers {
+		b := New(config)
+		name := "task" + strconv.Itoa(i)
+		err := b.Run(&Task{
+			Name:   name,
+			Weight: 1,
+			Fn: func() {
+				time.Sleep(10 * time.Millisecond)
+				b.Events.Publish("request_success", "test", name, int64(10), int64(1))
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		boomers[i] = b
+	}
+	waitFor(t, time.Second, func() bool { return m.WorkerCount() == 2 })
+
+	if err := m.Hatch(2, 2); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 2*slaveReportInterval, func() bool { return len(m.Entries()) == 2 })
+
+	for _, entry := range m.Entries() {
+		if entry.Method != "test" || entry.NumRequests == 0 {
+			t.Error("unexpected stats", entry.Method, entry.Name, entry.NumRequests)
+		}
+	}
+
+	for _, b := range boomers {
+		b.Quit()
+	}
+	waitFor(t, time.Second, func() bool { return m.WorkerCount() == 0 })
+}
+
+func TestHistogramPrecisionFlag(t *testing.T) {
+	config := DefaultConfig()
+	b := newBoomer(config, EventBus.New())
+	// stats are created again
+	defer func() { b.stats.close() }()
+
+	fs := flag.NewFlagSet("boomer", flag.ContinueOnError)
+	config.RegisterFlags(fs)
+	if err := fs.Parse([]string{"--histogram-precision=1ms"}); err != nil {
+		t.Fatal(err)
+	}
+	b.setConfig(config)
+	if b.stats.precision != time.Millisecond || b.stats.total.histogram.unit != time.Millisecond {
+		t.Error("histograms should be in the precision of the flag, got", b.stats.precision)
+	}
+
+	// requests are still recorded after stats are created again
+	b.Events.Publish("request_success", "http", "foo", int64(10), int64(10))
+	data := b.stats.flush()
+	if total := data["stats_total"].(map[string]interface{}); total["num_requests"] != int64(1) {
+		t.Error("the request should be recorded, got", total["num_requests"])
+	}
+}
+
+func TestStandalone(t *testing.T) {
+	config := DefaultConfig()
+	config.Standalone = true
+	config.NumClients = 3
+	config.HatchRate = 100
+	config.RunTime = 500 * time.Millisecond
+	config.HeartbeatInterval = 0
+
+	var counter int64
+	b := New(config)
+	err := b.Run(&Task{
+		Name:   "foo",
+		Weight: 1,
+		Fn: func() {
+			atomic.AddInt64(&counter, 1)
+			time.Sleep(10 * time.Millisecond)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// users are hatched without a master
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&b.runner.numClients) == 3 })
+
+	select {
+	case <-b.Finished():
+	case <-time.After(5 * time.Second):
+		t.Fatal("users aren't finished at the end of run time")
+	}
+	if atomic.LoadInt64(&counter) == 0 {
+		t.Error("tasks should run")
+	}
+
+	quit := make(chan bool)
+	go func() {
+		b.Quit()
+		close(quit)
+	}()
+	select {
+	case <-quit:
+	case <-time.After(time.Second):
+		t.Fatal("quit should return in standalone mode")
+	}
+}
+
+func TestLocalClientReturnsAfterQuit(t *testing.T) {
+	toMaster := make(chan *message)
+	disconnected := make(chan bool)
+	newLocalClient(toMaster, disconnected)
+
+	toMaster <- newMessage("quit", nil, "")
+	<-disconnected
+
+	select {
+	case toMaster <- newMessage("heartbeat", nil, ""):
+		t.Error("the client should return after quit")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRunReturnsErrorOnInvalidConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.Standalone = true
+	config.Executor = "foo"
+	b := New(config)
+	defer b.stats.close()
+	if err := b.Run(&Task{Name: "foo", Fn: func() {}}); err == nil {
+		t.Error("an unknown executor should be rejected")
+	}
+
+	config = DefaultConfig()
+	config.Thresholds = []string{"p99 <"}
+	b = New(config)
+	defer b.stats.close()
+	if err := b.Run(&Task{Name: "foo", Fn: func() {}}); err == nil {
+		t.Error("an invalid threshold should be rejected")
+	}
+}
@@ -1,7 +1,8 @@
 package boomer
 
 import (
-	"flag"
+	"log"
+	"time"
 )
 
 type client interface {
@@ -9,16 +10,36 @@ type client interface {
 	send()
 }
 
-var fromMaster = make(chan *message, 100)
-var toMaster = make(chan *message, 100)
-var disconnectedFromMaster = make(chan bool)
+// Clients tell the runner about the connection with these messages,
+// they are never sent to the master.
+const (
+	disconnectedMessageType = "boomer:disconnected"
+	reconnectedMessageType  = "boomer:reconnected"
+)
 
-var masterHost *string
-var masterPort *int
-var rpc *string
+const (
+	reconnectMinBackoff = 1 * time.Second
+	reconnectMaxBackoff = 30 * time.Second
+)
 
-func init() {
-	masterHost = flag.String("master-host", "127.0.0.1", "Host or IP address of locust master for distributed load testing. Defaults to 127.0.0.1.")
-	masterPort = flag.Int("master-port", 5557, "The port to connect to that is used by the locust master for distributed load testing. Defaults to 5557.")
-	rpc = flag.String("rpc", "zeromq", "Choose zeromq or tcp socket to communicate with master, don't mix them up.")
+// retry calls connect until it succeeds, with exponential backoff between attempts.
+// It returns false if quit is closed before that.
+func retry(quit chan bool, connect func() error) bool {
+	backoff := reconnectMinBackoff
+	for {
+		err := connect()
+		if err == nil {
+			return true
+		}
+		log.Printf("Retry in %v\n", backoff)
+		select {
+		case <-quit:
+			return false
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+	}
 }
@@ -5,58 +5,196 @@ package boomer
 import (
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/zeromq/goczmq"
 )
 
+const (
+	// RecvFrame returns every czmqRecvTimeout, so quit and a silent master are noticed.
+	czmqRecvTimeout = 1 * time.Second
+	// libzmq reconnects by itself and never reports a lost master, so master is taken as lost
+	// when it keeps silent for so long after its heartbeats. Masters send heartbeats every second.
+	masterSilenceTimeout = 5 * time.Second
+)
+
 type czmqSocketClient struct {
+	pushAddr string
+	pullAddr string
+	// identity is set for a dealer socket, which both sends and receives on pushAddr.
+	identity string
+
+	mutex    sync.Mutex
 	pushConn *goczmq.Sock
 	pullConn *goczmq.Sock
+
+	fromMaster             chan *message
+	toMaster               chan *message
+	disconnectedFromMaster chan bool
+	quitChannel            chan bool
 }
 
-func newClient() client {
+func newClient(rpc string, masterHost string, masterPort int, fromMaster chan *message, toMaster chan *message, disconnectedFromMaster chan bool) client {
 	log.Println("Boomer is built with goczmq support.")
-	var client client
 	var message string
-	if *rpc == "zeromq" {
-		client = newZmqClient(*masterHost, *masterPort)
-		message = fmt.Sprintf("Boomer is connected to master(%s:%d|%d) press Ctrl+c to quit.", *masterHost, *masterPort, *masterPort+1)
-	} else if *rpc == "socket" {
-		client = newSocketClient(*masterHost, *masterPort)
-		message = fmt.Sprintf("Boomer is connected to master(%s:%d) press Ctrl+c to quit.", *masterHost, *masterPort)
+	var client client
+	if rpc == "zeromq" {
+		client = newZmqClient(masterHost, masterPort, fromMaster, toMaster, disconnectedFromMaster)
+		message = fmt.Sprintf("Boomer is connected to master(%s:%d|%d) press Ctrl+c to quit.", masterHost, masterPort, masterPort+1)
+	} else if rpc == "socket" {
+		client = newSocketClient(masterHost, masterPort, fromMaster, toMaster, disconnectedFromMaster)
+		message = fmt.Sprintf("Boomer is connected to master(%s:%d) press Ctrl+c to quit.", masterHost, masterPort)
 	} else {
-		log.Fatal("Unknown rpc type:", *rpc)
+		log.Fatal("Unknown rpc type:", rpc)
 	}
 	log.Println(message)
 	return client
 }
 
-func newZmqClient(masterHost string, masterPort int) *czmqSocketClient {
-	tcpAddr := fmt.Sprintf("tcp://%s:%d", masterHost, masterPort)
-	pushConn, err := goczmq.NewPush(tcpAddr)
-	if err != nil {
-		log.Fatalf("Failed to create zeromq pusher, %s", err)
-	}
-	tcpAddr = fmt.Sprintf(">tcp://%s:%d", masterHost, masterPort+1)
-	pullConn, err := goczmq.NewPull(tcpAddr)
-	if err != nil {
-		log.Fatalf("Failed to create zeromq puller, %s", err)
+// newDealerClient connects to the router socket of locust 1.x and newer.
+func newDealerClient(masterHost string, masterPort int, identity string, fromMaster chan *message, toMaster chan *message, disconnectedFromMaster chan bool) client {
+	log.Println("Boomer is built with goczmq support.")
+	newClient := &czmqSocketClient{
+		pushAddr: fmt.Sprintf("tcp://%s:%d", masterHost, masterPort),
+		// locust tells workers apart by the identity
+		identity: identity,
+
+		fromMaster:             fromMaster,
+		toMaster:               toMaster,
+		disconnectedFromMaster: disconnectedFromMaster,
+		quitChannel:            make(chan bool),
 	}
-	log.Println("ZMQ sockets connected")
+	retry(newClient.quitChannel, newClient.connect)
+	go newClient.recv()
+	go newClient.send()
+	log.Printf("Boomer is connected to master(%s:%d) press Ctrl+c to quit.\n", masterHost, masterPort)
+	return newClient
+}
+
+func newZmqClient(masterHost string, masterPort int, fromMaster chan *message, toMaster chan *message, disconnectedFromMaster chan bool) *czmqSocketClient {
 	newClient := &czmqSocketClient{
-		pushConn: pushConn,
-		pullConn: pullConn,
+		pushAddr: fmt.Sprintf("tcp://%s:%d", masterHost, masterPort),
+		pullAddr: fmt.Sprintf(">tcp://%s:%d", masterHost, masterPort+1),
+
+		fromMaster:             fromMaster,
+		toMaster:               toMaster,
+		disconnectedFromMaster: disconnectedFromMaster,
+		quitChannel:            make(chan bool),
 	}
+	retry(newClient.quitChannel, newClient.connect)
 	go newClient.recv()
 	go newClient.send()
 	return newClient
 }
 
+// connect creates new sockets, the old ones are destroyed with the messages queued in them.
+func (c *czmqSocketClient) connect() error {
+	var pushConn, pullConn *goczmq.Sock
+	if c.identity != "" {
+		dealerConn := goczmq.NewSock(goczmq.Dealer)
+		dealerConn.SetIdentity(c.identity)
+		if err := dealerConn.Connect(c.pushAddr); err != nil {
+			log.Printf("Failed to create zeromq dealer, %s\n", err)
+			dealerConn.Destroy()
+			return err
+		}
+		log.Println("ZMQ dealer socket connected")
+		pushConn, pullConn = dealerConn, dealerConn
+	} else {
+		var err error
+		pushConn, err = goczmq.NewPush(c.pushAddr)
+		if err != nil {
+			log.Printf("Failed to create zeromq pusher, %s\n", err)
+			return err
+		}
+		pullConn, err = goczmq.NewPull(c.pullAddr)
+		if err != nil {
+			log.Printf("Failed to create zeromq puller, %s\n", err)
+			pushConn.Destroy()
+			return err
+		}
+		log.Println("ZMQ sockets connected")
+	}
+	pullConn.SetRcvtimeo(int(czmqRecvTimeout / time.Millisecond))
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.destroy()
+	c.pushConn = pushConn
+	c.pullConn = pullConn
+	return nil
+}
+
+// destroy closes the sockets, c.mutex must be held.
+func (c *czmqSocketClient) destroy() {
+	if c.pushConn != nil {
+		c.pushConn.Destroy()
+	}
+	if c.pullConn != nil && c.pullConn != c.pushConn {
+		c.pullConn.Destroy()
+	}
+	c.pushConn, c.pullConn = nil, nil
+}
+
+func (c *czmqSocketClient) getPullConn() *goczmq.Sock {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.pullConn
+}
+
 func (c *czmqSocketClient) recv() {
+	lastReceived := time.Now()
+	// master is never taken as lost before it sends heartbeats, like locust before 1.0
+	heartbeated := false
+	disconnected := false
+	backoff := reconnectMinBackoff
+	silence := masterSilenceTimeout
 	for {
-		msg, _, _ := c.pullConn.RecvFrame()
-		msgFromMaster := newMessageFromBytes(msg)
-		fromMaster <- msgFromMaster
+		msg, _, err := c.getPullConn().RecvFrame()
+
+		select {
+		case <-c.quitChannel:
+			return
+		default:
+		}
+
+		if err == nil {
+			lastReceived = time.Now()
+			if disconnected {
+				log.Println("Reconnected to master", c.pushAddr)
+				disconnected = false
+				backoff = reconnectMinBackoff
+				silence = masterSilenceTimeout
+			}
+			msgFromMaster := newMessageFromBytes(msg)
+			if msgFromMaster.Type == "heartbeat" {
+				heartbeated = true
+			}
+			c.fromMaster <- msgFromMaster
+			continue
+		}
+
+		// RecvFrame has timed out
+		if !heartbeated || time.Since(lastReceived) < silence {
+			continue
+		}
+		if !disconnected {
+			log.Printf("Lost connection to master, it keeps silent for %v\n", silence)
+			disconnected = true
+			c.fromMaster <- newMessage(disconnectedMessageType, nil, "")
+		}
+		// register again with new sockets, until master answers
+		if !retry(c.quitChannel, c.connect) {
+			return
+		}
+		c.fromMaster <- newMessage(reconnectedMessageType, nil, "")
+		lastReceived = time.Now()
+		silence = backoff
+		backoff *= 2
+		if backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
 	}
 
 }
@@ -64,15 +202,22 @@ func (c *czmqSocketClient) recv() {
 func (c *czmqSocketClient) send() {
 	for {
 		select {
-		case msg := <-toMaster:
+		case msg := <-c.toMaster:
 			c.sendMessage(msg)
 			if msg.Type == "quit" {
-				disconnectedFromMaster <- true
+				close(c.quitChannel)
+				c.disconnectedFromMaster <- true
+				return
 			}
 		}
 	}
 }
 
 func (c *czmqSocketClient) sendMessage(msg *message) {
-	c.pushConn.SendFrame(msg.serialize(), 0)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	err := c.pushConn.SendFrame(msg.serialize(), 0)
+	if err != nil {
+		log.Printf("Error sending: %v\n", err)
+	}
 }
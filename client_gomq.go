@@ -7,89 +7,189 @@ import (
 	"log"
 	"net"
 	"strings"
+	"sync"
 
 	"github.com/zeromq/gomq"
 	"github.com/zeromq/gomq/zmtp"
 )
 
 type gomqSocketClient struct {
+	pushAddr string
+	pullAddr string
+	// identity is set for a dealer socket, which both sends and receives
+	// on pushAddr, locust 1.x and newer use it to tell workers apart.
+	identity string
+
+	mutex      sync.Mutex
 	pushSocket *gomq.Socket
 	pullSocket *gomq.Socket
+
+	fromMaster             chan *message
+	toMaster               chan *message
+	disconnectedFromMaster chan bool
+	quitChannel            chan bool
 }
 
-func newClient() client {
+func newClient(rpc string, masterHost string, masterPort int, fromMaster chan *message, toMaster chan *message, disconnectedFromMaster chan bool) client {
 	log.Println("Boomer is built with gomq support.")
 	var message string
 	var client client
-	if *rpc == "zeromq" {
-		client = newZmqClient(*masterHost, *masterPort)
-		message = fmt.Sprintf("Boomer is connected to master(%s:%d|%d) press Ctrl+c to quit.", *masterHost, *masterPort, *masterPort+1)
-	} else if *rpc == "socket" {
-		client = newSocketClient(*masterHost, *masterPort)
-		message = fmt.Sprintf("Boomer is connected to master(%s:%d) press Ctrl+c to quit.", *masterHost, *masterPort)
+	if rpc == "zeromq" {
+		client = newZmqClient(masterHost, masterPort, fromMaster, toMaster, disconnectedFromMaster)
+		message = fmt.Sprintf("Boomer is connected to master(%s:%d|%d) press Ctrl+c to quit.", masterHost, masterPort, masterPort+1)
+	} else if rpc == "socket" {
+		client = newSocketClient(masterHost, masterPort, fromMaster, toMaster, disconnectedFromMaster)
+		message = fmt.Sprintf("Boomer is connected to master(%s:%d) press Ctrl+c to quit.", masterHost, masterPort)
 	} else {
-		log.Fatal("Unknown rpc type:", *rpc)
+		log.Fatal("Unknown rpc type:", rpc)
 	}
 	log.Println(message)
 	return client
 }
 
-func newGomqSocket(socketType zmtp.SocketType) *gomq.Socket {
-	socket := gomq.NewSocket(false, socketType, nil, zmtp.NewSecurityNull())
+// newDealerClient connects to the router socket of locust 1.x and newer.
+func newDealerClient(masterHost string, masterPort int, identity string, fromMaster chan *message, toMaster chan *message, disconnectedFromMaster chan bool) client {
+	log.Println("Boomer is built with gomq support.")
+	newClient := &gomqSocketClient{
+		pushAddr: fmt.Sprintf("tcp://%s:%d", masterHost, masterPort),
+		identity: identity,
+
+		fromMaster:             fromMaster,
+		toMaster:               toMaster,
+		disconnectedFromMaster: disconnectedFromMaster,
+		quitChannel:            make(chan bool),
+	}
+	retry(newClient.quitChannel, newClient.connect)
+	go newClient.recv()
+	go newClient.send()
+	log.Printf("Boomer is connected to master(%s:%d) press Ctrl+c to quit.\n", masterHost, masterPort)
+	return newClient
+}
+
+func newGomqSocket(socketType zmtp.SocketType, identity string) *gomq.Socket {
+	var socketIdentity zmtp.SocketIdentity
+	if identity != "" {
+		socketIdentity = zmtp.SocketIdentity(identity)
+	}
+	socket := gomq.NewSocket(false, socketType, socketIdentity, zmtp.NewSecurityNull())
 	return socket
 }
 
-func getNetConn(addr string) net.Conn {
+func getNetConn(addr string) (net.Conn, error) {
 	parts := strings.Split(addr, "://")
-	netConn, err := net.Dial(parts[0], parts[1])
-	if err != nil {
-		log.Fatal(err)
-	}
-	return netConn
+	return net.Dial(parts[0], parts[1])
 }
 
-func connectSock(socket *gomq.Socket, addr string) {
-	netConn := getNetConn(addr)
+func connectSock(socket *gomq.Socket, addr string) error {
+	netConn, err := getNetConn(addr)
+	if err != nil {
+		return err
+	}
 	zmtpConn := zmtp.NewConnection(netConn)
-	_, err := zmtpConn.Prepare(socket.SecurityMechanism(), socket.SocketType(), nil, false, nil)
+	_, err = zmtpConn.Prepare(socket.SecurityMechanism(), socket.SocketType(), socket.SocketIdentity(), false, nil)
 	if err != nil {
-		log.Fatal(err)
+		netConn.Close()
+		return err
 	}
 	conn := gomq.NewConnection(netConn, zmtpConn)
 	socket.AddConnection(conn)
 	zmtpConn.Recv(socket.RecvChannel())
+	return nil
 }
 
-func newZmqClient(masterHost string, masterPort int) *gomqSocketClient {
-	pushAddr := fmt.Sprintf("tcp://%s:%d", masterHost, masterPort)
-	pullAddr := fmt.Sprintf("tcp://%s:%d", masterHost, masterPort+1)
+func newZmqClient(masterHost string, masterPort int, fromMaster chan *message, toMaster chan *message, disconnectedFromMaster chan bool) *gomqSocketClient {
+	newClient := &gomqSocketClient{
+		pushAddr: fmt.Sprintf("tcp://%s:%d", masterHost, masterPort),
+		pullAddr: fmt.Sprintf("tcp://%s:%d", masterHost, masterPort+1),
 
-	pushSocket := newGomqSocket(zmtp.PushSocketType)
-	connectSock(pushSocket, pushAddr)
+		fromMaster:             fromMaster,
+		toMaster:               toMaster,
+		disconnectedFromMaster: disconnectedFromMaster,
+		quitChannel:            make(chan bool),
+	}
+	retry(newClient.quitChannel, newClient.connect)
+	go newClient.recv()
+	go newClient.send()
+	return newClient
+}
 
-	pullSocket := newGomqSocket(zmtp.PullSocketType)
-	connectSock(pullSocket, pullAddr)
+func (c *gomqSocketClient) connect() error {
+	if c.identity != "" {
+		return c.connectDealer()
+	}
+
+	pushSocket := newGomqSocket(zmtp.PushSocketType, "")
+	if err := connectSock(pushSocket, c.pushAddr); err != nil {
+		log.Printf("Failed to connect to the Locust master: %s %s\n", c.pushAddr, err)
+		return err
+	}
+
+	pullSocket := newGomqSocket(zmtp.PullSocketType, "")
+	if err := connectSock(pullSocket, c.pullAddr); err != nil {
+		log.Printf("Failed to connect to the Locust master: %s %s\n", c.pullAddr, err)
+		pushSocket.Close()
+		return err
+	}
 
 	log.Println("ZMQ sockets connected")
 
-	newClient := &gomqSocketClient{
-		pushSocket: pushSocket,
-		pullSocket: pullSocket,
+	c.mutex.Lock()
+	c.pushSocket = pushSocket
+	c.pullSocket = pullSocket
+	c.mutex.Unlock()
+	return nil
+}
+
+func (c *gomqSocketClient) connectDealer() error {
+	dealerSocket := newGomqSocket(zmtp.DealerSocketType, c.identity)
+	if err := connectSock(dealerSocket, c.pushAddr); err != nil {
+		log.Printf("Failed to connect to the Locust master: %s %s\n", c.pushAddr, err)
+		return err
 	}
-	go newClient.recv()
-	go newClient.send()
-	return newClient
+
+	log.Println("ZMQ dealer socket connected")
+
+	c.mutex.Lock()
+	c.pushSocket = dealerSocket
+	c.pullSocket = dealerSocket
+	c.mutex.Unlock()
+	return nil
+}
+
+func (c *gomqSocketClient) getSockets() (pushSocket *gomq.Socket, pullSocket *gomq.Socket) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.pushSocket, c.pullSocket
 }
 
 func (c *gomqSocketClient) recv() {
 	for {
-		msg, err := c.pullSocket.Recv()
-		if err != nil {
-			log.Printf("Error reading: %v\n", err)
-		} else {
+		pushSocket, pullSocket := c.getSockets()
+		msg, err := pullSocket.Recv()
+		if err == nil {
 			msgFromMaster := newMessageFromBytes(msg)
-			fromMaster <- msgFromMaster
+			c.fromMaster <- msgFromMaster
+			continue
+		}
+
+		select {
+		case <-c.quitChannel:
+			return
+		default:
+		}
+
+		// gomq keeps returning errors once the connection is broken, so reconnect
+		log.Printf("Lost connection to master: %v\n", err)
+		pushSocket.Close()
+		if pullSocket != pushSocket {
+			pullSocket.Close()
+		}
+		c.fromMaster <- newMessage(disconnectedMessageType, nil, "")
+		if !retry(c.quitChannel, c.connect) {
+			return
 		}
+		log.Println("Reconnected to master", c.pushAddr)
+		c.fromMaster <- newMessage(reconnectedMessageType, nil, "")
 	}
 
 }
@@ -97,17 +197,27 @@ func (c *gomqSocketClient) recv() {
 func (c *gomqSocketClient) send() {
 	for {
 		select {
-		case msg := <-toMaster:
+		case msg := <-c.toMaster:
 			c.sendMessage(msg)
 			if msg.Type == "quit" {
-				disconnectedFromMaster <- true
+				close(c.quitChannel)
+				// recv gets an error and returns
+				pushSocket, pullSocket := c.getSockets()
+				pushSocket.Close()
+				if pullSocket != pushSocket {
+					pullSocket.Close()
+				}
+				c.disconnectedFromMaster <- true
+				return
 			}
 		}
 	}
 }
 
 func (c *gomqSocketClient) sendMessage(msg *message) {
-	err := c.pushSocket.Send(msg.serialize())
+	// while reconnecting, messages are dropped
+	pushSocket, _ := c.getSockets()
+	err := pushSocket.Send(msg.serialize())
 	if err != nil {
 		log.Printf("Error sending: %v\n", err)
 	}
@@ -0,0 +1,47 @@
+package boomer
+
+import (
+	"log"
+)
+
+// localClient is used in standalone mode, there is no master to talk to.
+// Messages sent to the master are consumed locally, stats are printed by ConsoleOutput.
+type localClient struct {
+	toMaster               chan *message
+	disconnectedFromMaster chan bool
+}
+
+func newLocalClient(toMaster chan *message, disconnectedFromMaster chan bool) *localClient {
+	log.Println("Boomer is running in standalone mode, press Ctrl+c to quit.")
+	newClient := &localClient{
+		toMaster:               toMaster,
+		disconnectedFromMaster: disconnectedFromMaster,
+	}
+	go newClient.recv()
+	go newClient.send()
+	return newClient
+}
+
+func (c *localClient) recv() {
+	// nothing comes from a master in standalone mode
+}
+
+func (c *localClient) send() {
+	for {
+		select {
+		case msg := <-c.toMaster:
+			c.sendMessage(msg)
+			if msg.Type == "quit" {
+				c.disconnectedFromMaster <- true
+				return
+			}
+		}
+	}
+}
+
+func (c *localClient) sendMessage(msg *message) {
+	switch msg.Type {
+	case "hatch_complete":
+		log.Println("All", msg.Data["count"], "clients hatched")
+	}
+}
@@ -4,49 +4,106 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"sync"
 )
 
 type socketClient struct {
-	conn *net.TCPConn
+	serverAddr string
+
+	mutex sync.Mutex
+	conn  *net.TCPConn
+
+	fromMaster             chan *message
+	toMaster               chan *message
+	disconnectedFromMaster chan bool
+	quitChannel            chan bool
 }
 
-func newSocketClient(masterHost string, masterPort int) *socketClient {
-	serverAddr := fmt.Sprintf("%s:%d", masterHost, masterPort)
-	tcpAddr, _ := net.ResolveTCPAddr("tcp", serverAddr)
-	conn, err := net.DialTCP("tcp", nil, tcpAddr)
-	if err != nil {
-		log.Fatalf("Failed to connect to the Locust master: %s %s", serverAddr, err)
-	}
-	conn.SetNoDelay(true)
+func newSocketClient(masterHost string, masterPort int, fromMaster chan *message, toMaster chan *message, disconnectedFromMaster chan bool) *socketClient {
 	newClient := &socketClient{
-		conn: conn,
+		serverAddr: fmt.Sprintf("%s:%d", masterHost, masterPort),
+
+		fromMaster:             fromMaster,
+		toMaster:               toMaster,
+		disconnectedFromMaster: disconnectedFromMaster,
+		quitChannel:            make(chan bool),
 	}
+	retry(newClient.quitChannel, newClient.connect)
 	go newClient.recv()
 	go newClient.send()
 	return newClient
 }
 
-func (c *socketClient) recvBytes(length int) []byte {
+func (c *socketClient) connect() error {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", c.serverAddr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTCP("tcp", nil, tcpAddr)
+	if err != nil {
+		log.Printf("Failed to connect to the Locust master: %s %s\n", c.serverAddr, err)
+		return err
+	}
+	conn.SetNoDelay(true)
+
+	c.mutex.Lock()
+	c.conn = conn
+	c.mutex.Unlock()
+	return nil
+}
+
+func (c *socketClient) getConn() *net.TCPConn {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.conn
+}
+
+func (c *socketClient) recvBytes(conn *net.TCPConn, length int) ([]byte, error) {
 	buf := make([]byte, length)
-	for length > 0 {
-		n, err := c.conn.Read(buf)
-		if err != nil {
-			log.Fatal(err)
-		}
-		length = length - n
+	_, err := io.ReadFull(conn, buf)
+	return buf, err
+}
+
+func (c *socketClient) recvMessage(conn *net.TCPConn) (*message, error) {
+	h, err := c.recvBytes(conn, 4)
+	if err != nil {
+		return nil, err
+	}
+	msgLength := binary.BigEndian.Uint32(h)
+	msg, err := c.recvBytes(conn, int(msgLength))
+	if err != nil {
+		return nil, err
 	}
-	return buf
+	return newMessageFromBytes(msg), nil
 }
 
 func (c *socketClient) recv() {
 	for {
-		h := c.recvBytes(4)
-		msgLength := binary.BigEndian.Uint32(h)
-		msg := c.recvBytes(int(msgLength))
-		msgFromMaster := newMessageFromBytes(msg)
-		fromMaster <- msgFromMaster
+		conn := c.getConn()
+		msgFromMaster, err := c.recvMessage(conn)
+		if err == nil {
+			c.fromMaster <- msgFromMaster
+			continue
+		}
+
+		select {
+		case <-c.quitChannel:
+			// the connection is closed after quit
+			return
+		default:
+		}
+
+		log.Printf("Lost connection to master: %v\n", err)
+		conn.Close()
+		c.fromMaster <- newMessage(disconnectedMessageType, nil, "")
+		if !retry(c.quitChannel, c.connect) {
+			return
+		}
+		log.Println("Reconnected to master", c.serverAddr)
+		c.fromMaster <- newMessage(reconnectedMessageType, nil, "")
 	}
 
 }
@@ -54,10 +111,13 @@ func (c *socketClient) recv() {
 func (c *socketClient) send() {
 	for {
 		select {
-		case msg := <-toMaster:
+		case msg := <-c.toMaster:
 			c.sendMessage(msg)
 			if msg.Type == "quit" {
-				disconnectedFromMaster <- true
+				close(c.quitChannel)
+				c.getConn().Close()
+				c.disconnectedFromMaster <- true
+				return
 			}
 		}
 	}
@@ -74,5 +134,10 @@ func (c *socketClient) sendMessage(msg *message) {
 
 	binary.Write(buf, binary.BigEndian, int32(len(packed)))
 	buf.Write(packed)
-	c.conn.Write(buf.Bytes())
+
+	// while reconnecting, messages are dropped
+	_, err := c.getConn().Write(buf.Bytes())
+	if err != nil {
+		log.Printf("Error sending: %v\n", err)
+	}
 }
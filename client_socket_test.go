@@ -0,0 +1,64 @@
+package boomer
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func readMessage(t *testing.T, conn net.Conn) *message {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, binary.BigEndian.Uint32(header))
+	if _, err := io.ReadFull(conn, body); err != nil {
+		t.Fatal(err)
+	}
+	return newMessageFromBytes(body)
+}
+
+func TestReconnectToMaster(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	config := DefaultConfig()
+	config.MasterPort = listener.Addr().(*net.TCPAddr).Port
+	config.RPC = "socket"
+	b := New(config)
+	if err := b.Run(&Task{Name: "foo", Fn: func() {}}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready := readMessage(t, conn)
+	if ready.Type != "client_ready" {
+		t.Fatal("expected client_ready, got", ready.Type)
+	}
+
+	// master restarts
+	conn.Close()
+
+	conn, err = listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := readMessage(t, conn)
+	if msg.Type != "client_ready" || msg.NodeID != ready.NodeID {
+		t.Error("boomer should register again with the same node id", msg.Type, msg.NodeID)
+	}
+
+	b.Quit()
+	if msg := readMessage(t, conn); msg.Type != "quit" {
+		t.Error("expected quit, got", msg.Type)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+// A headless locust compatible master written in go.
+//
+// It waits for the expected workers to connect, tells them to hatch,
+// prints the aggregated stats and quits when the run time is over.
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/myzhan/boomer/master"
+)
+
+var bindHost string
+var bindPort int
+var rpc string
+var expectWorkers int
+var numClients int
+var hatchRate float64
+var runTime time.Duration
+
+func printStats(m *master.Master) {
+	total := m.Total()
+	log.Printf("Workers: %d, users: %d, requests: %d, failures: %d, avg: %.2fms, min: %.2fms, max: %.2fms, 50%%: %dms, 95%%: %dms\n",
+		m.WorkerCount(), m.UserCount(), total.NumRequests, total.NumFailures, total.AvgResponseTime(),
+		total.MinResponseTime, total.MaxResponseTime, total.Percentile(50), total.Percentile(95))
+}
+
+func main() {
+	flag.Parse()
+
+	m := master.New(bindHost, bindPort, rpc)
+	if err := m.Run(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Master is listening on %s:%d, waiting for %d workers\n", bindHost, bindPort, expectWorkers)
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+
+	for m.WorkerCount() < expectWorkers {
+		select {
+		case <-c:
+			m.Quit()
+			return
+		case <-time.After(time.Second):
+		}
+	}
+
+	if err := m.Hatch(numClients, hatchRate); err != nil {
+		log.Fatal(err)
+	}
+
+	var timeout <-chan time.Time
+	if runTime > 0 {
+		timeout = time.After(runTime)
+	}
+	ticker := time.NewTicker(3 * time.Second)
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			printStats(m)
+		case <-c:
+			break loop
+		case <-timeout:
+			log.Println("Time limit reached, shutting down...")
+			break loop
+		}
+	}
+
+	m.Stop()
+	// give workers a chance to report the last stats
+	time.Sleep(3 * time.Second)
+	printStats(m)
+	for _, entry := range m.Entries() {
+		log.Printf("%s %s, requests: %d, failures: %d, avg: %.2fms, 95%%: %dms\n", entry.Method, entry.Name,
+			entry.NumRequests, entry.NumFailures, entry.AvgResponseTime(), entry.Percentile(95))
+	}
+	for _, e := range m.Errors() {
+		log.Printf("%s %s, occurences: %d, error: %s\n", e.Method, e.Name, e.Occurences, e.Error)
+	}
+	m.Quit()
+}
+
+func init() {
+	flag.StringVar(&bindHost, "master-bind-host", "0.0.0.0", "Interfaces (hostname, ip) that master should bind to.")
+	flag.IntVar(&bindPort, "master-bind-port", 5557, "Port that master should bind to. With zeromq, master-bind-port+1 is bound as well.")
+	flag.StringVar(&rpc, "rpc", "socket", "Choose zeromq or tcp socket to communicate with workers, zeromq requires the goczmq build tag.")
+	flag.IntVar(&expectWorkers, "expect-workers", 1, "How many workers master should wait for before starting the test.")
+	flag.IntVar(&numClients, "clients", 1, "Number of concurrent clients in total.")
+	flag.Float64Var(&hatchRate, "hatch-rate", 1, "The rate per second in which clients are spawned in total.")
+	flag.DurationVar(&runTime, "run-time", 0, "Stop after the specified amount of time, e.g. 300s, 5m, 1h30m. Defaults to run forever.")
+}
@@ -0,0 +1,32 @@
+package boomer
+
+import (
+	"time"
+)
+
+// cpuMonitor measures the cpu usage of this process between two calls of usage,
+// the same as psutil's cpu_percent in locust, 100 means one core is busy.
+type cpuMonitor struct {
+	lastCPUTime time.Duration
+	lastTime    time.Time
+}
+
+func newCPUMonitor() *cpuMonitor {
+	return &cpuMonitor{
+		lastCPUTime: processCPUTime(),
+		lastTime:    time.Now(),
+	}
+}
+
+func (m *cpuMonitor) usage() float64 {
+	cpuTime := processCPUTime()
+	now := time.Now()
+	elapsed := now.Sub(m.lastTime)
+	percent := 0.0
+	if elapsed > 0 {
+		percent = float64(cpuTime-m.lastCPUTime) / float64(elapsed) * 100
+	}
+	m.lastCPUTime = cpuTime
+	m.lastTime = now
+	return percent
+}
@@ -0,0 +1,17 @@
+// +build !windows
+
+package boomer
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime returns the user and system cpu time used by this process.
+func processCPUTime() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
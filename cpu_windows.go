@@ -0,0 +1,12 @@
+// +build windows
+
+package boomer
+
+import (
+	"time"
+)
+
+// processCPUTime isn't implemented on windows, cpu usage is always reported as 0.
+func processCPUTime() time.Duration {
+	return 0
+}
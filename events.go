@@ -3,46 +3,70 @@ package boomer
 import (
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/asaskevich/EventBus"
 )
 
-// Events is core event bus instance of boomer
+// Events is the event bus of the default boomer, which is used by Run.
+// It's kept for compatibility, RecordSuccess and RecordFailure are preferred.
 var Events = EventBus.New()
 
+// RecordSuccess reports a success to the default boomer.
+func RecordSuccess(requestType, name string, responseTime time.Duration, responseLength int64) {
+	defaultBoomer.RecordSuccess(requestType, name, responseTime, responseLength)
+}
+
+// RecordFailure reports a failure to the default boomer.
+func RecordFailure(requestType, name string, responseTime time.Duration, err error) {
+	defaultBoomer.RecordFailure(requestType, name, responseTime, err)
+}
+
+// RecordSuccess reports a success, like locust's events.request_success.fire.
+func (b *Boomer) RecordSuccess(requestType, name string, responseTime time.Duration, responseLength int64) {
+	b.stats.logRequest(requestType, name, responseTime, responseLength)
+}
+
+// RecordFailure reports a failure, like locust's events.request_failure.fire.
+func (b *Boomer) RecordFailure(requestType, name string, responseTime time.Duration, err error) {
+	exception := "unknown error"
+	if err != nil {
+		exception = err.Error()
+	}
+	b.stats.logError(requestType, name, exception)
+}
+
 // According to locust, responseTime should be int64, in milliseconds.
 // But previous version of boomer required responseTime to be float64, so sad.
-func convertResponseTime(origin interface{}) int64 {
-	responseTime := int64(0)
+// The fraction of float64 is kept, so 0.25 is 250 microseconds.
+func convertResponseTime(origin interface{}) time.Duration {
+	responseTime := time.Duration(0)
 	if _, ok := origin.(float64); ok {
-		responseTime = int64(origin.(float64))
+		responseTime = time.Duration(origin.(float64) * float64(time.Millisecond))
 	} else if _, ok := origin.(int64); ok {
-		responseTime = origin.(int64)
+		responseTime = time.Duration(origin.(int64)) * time.Millisecond
 	} else {
 		panic(fmt.Sprintf("responseTime should be float64 or int64, not %s", reflect.TypeOf(origin)))
 	}
 	return responseTime
 }
 
-func requestSuccessHandler(requestType string, name string, responseTime interface{}, responseLength int64) {
-	requestSuccessChannel <- &requestSuccess{
-		requestType:    requestType,
-		name:           name,
-		responseTime:   convertResponseTime(responseTime),
-		responseLength: responseLength,
-	}
+// requestSuccessHandler and requestFailureHandler are the compatibility shim of Events.
+
+func (s *requestStats) requestSuccessHandler(requestType string, name string, responseTime interface{}, responseLength int64) {
+	s.logRequest(requestType, name, convertResponseTime(responseTime), responseLength)
 }
 
-func requestFailureHandler(requestType string, name string, responseTime interface{}, exception string) {
-	requestFailureChannel <- &requestFailure{
-		requestType:  requestType,
-		name:         name,
-		responseTime: convertResponseTime(responseTime),
-		error:        exception,
-	}
+func (s *requestStats) requestFailureHandler(requestType string, name string, responseTime interface{}, exception string) {
+	s.logError(requestType, name, exception)
+}
+
+func (s *requestStats) subscribe(events EventBus.Bus) {
+	events.Subscribe("request_success", s.requestSuccessHandler)
+	events.Subscribe("request_failure", s.requestFailureHandler)
 }
 
-func init() {
-	Events.Subscribe("request_success", requestSuccessHandler)
-	Events.Subscribe("request_failure", requestFailureHandler)
+func (s *requestStats) unsubscribe(events EventBus.Bus) {
+	events.Unsubscribe("request_success", s.requestSuccessHandler)
+	events.Unsubscribe("request_failure", s.requestFailureHandler)
 }
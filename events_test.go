@@ -0,0 +1,65 @@
+package boomer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asaskevich/EventBus"
+)
+
+// newIdleBoomer doesn't start collecting stats, so tests can merge shards by themselves.
+func newIdleBoomer() *Boomer {
+	b := &Boomer{
+		Events: EventBus.New(),
+		stats:  newRequestStats(time.Microsecond),
+	}
+	b.stats.subscribe(b.Events)
+	return b
+}
+
+func TestRecordSuccess(t *testing.T) {
+	b := newIdleBoomer()
+	b.RecordSuccess("http", "foo", 1500*time.Microsecond, 10)
+	b.stats.mergeShards()
+
+	entry := b.stats.get("foo", "http")
+	if entry.numRequests != 1 || entry.numFailures != 0 {
+		t.Error("wrong number of requests or failures", entry.numRequests, entry.numFailures)
+	}
+	if entry.totalResponseTime != 1500*time.Microsecond || entry.totalContentLength != 10 {
+		t.Error("wrong response time or length", entry.totalResponseTime, entry.totalContentLength)
+	}
+}
+
+func TestRecordFailure(t *testing.T) {
+	b := newIdleBoomer()
+	b.RecordFailure("udp", "bar", 2*time.Second, errors.New("udp error"))
+	b.RecordFailure("udp", "bar", 0, nil)
+	b.stats.mergeShards()
+
+	if entry := b.stats.get("bar", "udp"); entry.numFailures != 2 {
+		t.Error("wrong number of failures", entry.numFailures)
+	}
+	if e := b.stats.errors[MD5("udp", "bar", "udp error")]; e == nil || e.occurences != 1 {
+		t.Error("udp error isn't recorded", b.stats.errors)
+	}
+	if e := b.stats.errors[MD5("udp", "bar", "unknown error")]; e == nil || e.occurences != 1 {
+		t.Error("nil error should be reported as unknown error", b.stats.errors)
+	}
+}
+
+func TestPublishIsStillSupported(t *testing.T) {
+	b := newIdleBoomer()
+	b.Events.Publish("request_success", "http", "foo", 0.25, int64(10))
+	b.Events.Publish("request_success", "http", "foo", int64(100), int64(10))
+	b.stats.mergeShards()
+
+	entry := b.stats.get("foo", "http")
+	if entry.minResponseTime != 250*time.Microsecond {
+		t.Error("float64 response time should be converted, got", entry.minResponseTime)
+	}
+	if entry.maxResponseTime != 100*time.Millisecond {
+		t.Error("int64 response time should be converted, got", entry.maxResponseTime)
+	}
+}
@@ -40,24 +40,22 @@ func worker() {
 
 	request.Header.Set("Content-Type", contentType)
 
-	startTime := boomer.Now()
+	startTime := time.Now()
 
 	response, err := client.Do(request)
 
-	elapsed := boomer.Now() - startTime
+	elapsed := time.Since(startTime)
 
 	if err != nil {
 		if verbose {
 			log.Printf("%v\n", err)
 		}
-		boomer.Events.Publish("request_failure", "http", "error", 0.0, err.Error())
+		boomer.RecordFailure("http", "error", 0, err)
 	} else {
 		if response.StatusCode == http.StatusOK {
-			boomer.Events.Publish("request_success", "http", "200",
-				elapsed, response.ContentLength)
+			boomer.RecordSuccess("http", "200", elapsed, response.ContentLength)
 		} else {
-			boomer.Events.Publish("request_success", "http", strconv.Itoa(response.StatusCode),
-				elapsed, response.ContentLength)
+			boomer.RecordSuccess("http", strconv.Itoa(response.StatusCode), elapsed, response.ContentLength)
 		}
 
 		if verbose {
@@ -91,6 +89,8 @@ func main() {
 
 	flag.BoolVar(&verbose, "verbose", false, "Print debug log")
 
+	// flags are parsed here, so register boomer's flags first
+	boomer.RegisterFlags()
 	flag.Parse()
 
 	log.Printf(`HTTP benchmark is running with these args:
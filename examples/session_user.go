@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"time"
+
+	"github.com/myzhan/boomer"
+)
+
+// Every user logs in when it starts, keeps its cookies while browsing, and logs out when it's stopped.
+
+var baseURL string
+
+type sessionUser struct {
+	client *http.Client
+}
+
+func newSessionUser() boomer.User {
+	jar, _ := cookiejar.New(nil)
+	return &sessionUser{
+		client: &http.Client{Jar: jar, Timeout: 10 * time.Second},
+	}
+}
+
+func (u *sessionUser) OnStart(ctx context.Context) {
+	u.request(ctx, "POST", "/login")
+}
+
+func (u *sessionUser) OnStop() {
+	u.request(context.Background(), "POST", "/logout")
+}
+
+func (u *sessionUser) request(ctx context.Context, method, path string) {
+	request, err := http.NewRequest(method, baseURL+path, nil)
+	if err != nil {
+		boomer.RecordFailure("http", path, 0, err)
+		return
+	}
+	start := time.Now()
+	response, err := u.client.Do(request.WithContext(ctx))
+	elapsed := time.Since(start)
+	if err != nil {
+		boomer.RecordFailure("http", path, elapsed, err)
+		return
+	}
+	defer response.Body.Close()
+	length, _ := io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode >= 400 {
+		boomer.RecordFailure("http", path, elapsed, errors.New(response.Status))
+		return
+	}
+	boomer.RecordSuccess("http", path, elapsed, length)
+}
+
+func browse(ctx context.Context, user boomer.User) {
+	user.(*sessionUser).request(ctx, "GET", "/profile")
+}
+
+func main() {
+	flag.StringVar(&baseURL, "url", "http://localhost:8080", "The base URL of the site")
+	boomer.RegisterFlags()
+	flag.Parse()
+
+	task := &boomer.Task{
+		Name:    "session",
+		Weight:  10,
+		NewUser: newSessionUser,
+		FnUser:  browse,
+	}
+
+	boomer.Run(task)
+}
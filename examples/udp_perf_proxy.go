@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/myzhan/boomer"
@@ -26,9 +28,7 @@ import (
 // While requests from udpcopy passing through this udp server, it keeps track of qps and timeout.
 // Also, it can multi-copy the original request for more stress.
 
-// Known Issues:
-// 1. Once locust start the test, it can't be stopped by locust. You should restart locust and this udp server if you
-//    want to restart.
+// Requests are dropped unless locust is running a test, so the test can be stopped and started again in locust.
 
 // See also:
 // udpcopy: https://github.com/wangbin579/udpcopy
@@ -39,7 +39,7 @@ func sendReq(req []byte, addr string) {
 
 	conn, err := net.DialUDP("udp", nil, a)
 	if err != nil {
-		boomer.Events.Publish("request_failure", "udp-dial", name, 0.0, err.Error())
+		boomer.RecordFailure("udp-dial", name, 0, err)
 		return
 	}
 
@@ -47,24 +47,24 @@ func sendReq(req []byte, addr string) {
 
 	for n := 0; n < *number; n++ {
 
-		startTime := boomer.Now()
+		startTime := time.Now()
 
 		_, err = conn.Write(req)
 		if err != nil {
-			boomer.Events.Publish("request_failure", "udp-write", name, 0.0, err.Error())
+			boomer.RecordFailure("udp-write", name, 0, err)
 			return
 		}
 
 		resp := make([]byte, *udpBufferSize)
 		respLength, err := conn.Read(resp)
 		if err != nil {
-			boomer.Events.Publish("request_failure", "udp-read", name, 0.0, err.Error())
+			boomer.RecordFailure("udp-read", name, 0, err)
 			return
 		}
 
-		elapsed := boomer.Now() - startTime
+		elapsed := time.Since(startTime)
 
-		boomer.Events.Publish("request_success", "udp-resp", name, elapsed, int64(respLength))
+		boomer.RecordSuccess("udp-resp", name, elapsed, int64(respLength))
 	}
 
 }
@@ -90,7 +90,7 @@ func proxy() {
 			log.Printf("request size is larger than %d，please enlarge udp-buffer-size. current request is dropped.\n", *udpBufferSize)
 			continue
 		}
-		if !testStarted {
+		if atomic.LoadInt32(&runningUsers) == 0 {
 			// test is not started, drop current request.
 			continue
 		}
@@ -98,13 +98,13 @@ func proxy() {
 	}
 }
 
-func deadend() {
+func deadend(ctx context.Context) {
 
-	testStarted = true
+	atomic.AddInt32(&runningUsers, 1)
+	defer atomic.AddInt32(&runningUsers, -1)
 
-	for {
-		time.Sleep(time.Second * 100)
-	}
+	// wait until the test is stopped
+	<-ctx.Done()
 }
 
 func main() {
@@ -112,7 +112,7 @@ func main() {
 	task := &boomer.Task{
 		Name:   "udproxy",
 		Weight: 10,
-		Fn:     deadend,
+		FnCtx:  deadend,
 	}
 
 	go proxy()
@@ -122,7 +122,8 @@ func main() {
 
 const name = "udproxy"
 
-var testStarted = false
+// runningUsers is the number of running deadends
+var runningUsers int32
 
 var backendAddr *string
 var backendTimeout time.Duration
@@ -140,6 +141,7 @@ func init() {
 	proxyPort = flag.Int("proxy-port", 23333, "proxy bind-port")
 	udpBufferSize = flag.Int("udp-buffer-size", 10240, "udp recv buffer size")
 	number = flag.Int("number", 1, "the number of replication for multi-copying")
+	boomer.RegisterFlags()
 	flag.Parse()
 
 }
@@ -0,0 +1,169 @@
+package boomer
+
+import (
+	"context"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ExecutorUsers runs every user in a loop, so the load drops when the target slows down.
+	ExecutorUsers = "users"
+	// ExecutorArrivalRate starts iterations at a rate, no matter how long they take.
+	ExecutorArrivalRate = "arrival-rate"
+)
+
+const (
+	// ArrivalConstant starts iterations at fixed intervals.
+	ArrivalConstant = "constant"
+	// ArrivalPoisson starts iterations at exponentially distributed intervals.
+	ArrivalPoisson = "poisson"
+)
+
+// arrivalIdleTimeout is how long a worker of the arrival-rate executor waits for iterations before it exits.
+const arrivalIdleTimeout = 10 * time.Second
+
+// arrivalPool is the workers of the arrival-rate executor, it's kept when hatching again.
+// Workers exit after they're idle for idleTimeout, so the pool shrinks when the rate drops.
+type arrivalPool struct {
+	jobs chan *Task
+	// workers has a slot for every running worker
+	workers     chan struct{}
+	idleTimeout time.Duration
+}
+
+func newArrivalPool(maxWorkers int, idleTimeout time.Duration) *arrivalPool {
+	return &arrivalPool{
+		jobs:        make(chan *Task),
+		workers:     make(chan struct{}, maxWorkers),
+		idleTimeout: idleTimeout,
+	}
+}
+
+// spawnArrivals starts iterations at the rate of the number of users per second, and ramps
+// the rate up or down by hatchRate every second. Iterations run in a pool of at most maxWorkers
+// goroutines, and they are dropped if all the workers are busy. Dropped iterations aren't failures
+// of the target, they're counted in the "dropped_iterations" of reports. Workers keep running
+// when hatching again, until users are stopped.
+func (r *runner) spawnArrivals(ctx context.Context, target int, hatchRate int, hatch chan bool, pool *arrivalPool) {
+
+	log.Println("Starting iterations at the rate", target, "per second, ramping", hatchRate, "per second...")
+
+	tasks := &TaskSet{Tasks: r.tasks}
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	startRate := r.loadArrivalRate()
+	startTime := time.Now()
+	next := startTime
+	complete := false
+	for {
+		rate := rampRate(startRate, float64(target), float64(hatchRate), time.Since(startTime).Seconds())
+		r.storeArrivalRate(rate)
+		if !complete && rate == float64(target) {
+			complete = true
+			r.hatchComplete(int32(target))
+		}
+
+		// the rate starts from zero, the first iteration shouldn't wait for too long
+		interval := float64(time.Second) / math.Max(rate, math.Max(math.Min(float64(target), float64(hatchRate)), 1))
+		if r.arrivalDistribution == ArrivalPoisson {
+			interval *= random.ExpFloat64()
+		}
+		next = next.Add(time.Duration(interval))
+		if !r.wait(next.Sub(time.Now()), hatch) {
+			return
+		}
+
+		if r.iterations > 0 && atomic.LoadInt64(&r.iterationsStarted) >= r.iterations {
+			go r.finish("All the iterations are done")
+			return
+		}
+		task, _ := tasks.pick(random)
+		if task == nil {
+			return
+		}
+
+		select {
+		case pool.jobs <- task:
+			// an idle worker takes it
+		default:
+			select {
+			case pool.workers <- struct{}{}:
+			default:
+				atomic.AddInt64(&r.droppedIterations, 1)
+				continue
+			}
+			runningUsers := r.addUser(hatch)
+			if runningUsers == nil {
+				<-pool.workers
+				return
+			}
+			go r.arrivalWorker(ctx, runningUsers, pool, task)
+		}
+		atomic.AddInt64(&r.iterationsStarted, 1)
+	}
+}
+
+// arrivalWorker runs the task, and then the ones from the pool until users are stopped or it's idle for too long.
+// It has a User for every task it has run.
+func (r *runner) arrivalWorker(ctx context.Context, runningUsers *sync.WaitGroup, pool *arrivalPool, task *Task) {
+	defer func() {
+		<-pool.workers
+		atomic.AddInt32(&r.numClients, -1)
+		runningUsers.Done()
+	}()
+	users := make(map[*Task]User)
+	defer func() {
+		for _, user := range users {
+			if user != nil {
+				r.safeRun(user.OnStop)
+			}
+		}
+	}()
+
+	idle := time.NewTimer(pool.idleTimeout)
+	defer idle.Stop()
+	for {
+		user, ok := users[task]
+		if !ok {
+			user = task.newUser()
+			users[task] = user
+			if user != nil {
+				r.safeRun(func() { user.OnStart(ctx) })
+			}
+		}
+		r.safeRun(func() { task.run(ctx, user) })
+
+		if !idle.Stop() {
+			<-idle.C
+		}
+		idle.Reset(pool.idleTimeout)
+		select {
+		case task = <-pool.jobs:
+		case <-idle.C:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// rampRate returns the rate after ramping from one to another for elapsed seconds.
+func rampRate(from, to, perSecond, elapsed float64) float64 {
+	if from < to {
+		return math.Min(to, from+perSecond*elapsed)
+	}
+	return math.Max(to, from-perSecond*elapsed)
+}
+
+func (r *runner) loadArrivalRate() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&r.arrivalRate))
+}
+
+func (r *runner) storeArrivalRate(rate float64) {
+	atomic.StoreUint64(&r.arrivalRate, math.Float64bits(rate))
+}
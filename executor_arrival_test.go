@@ -0,0 +1,116 @@
+package boomer
+
+import (
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRampRate(t *testing.T) {
+	if rate := rampRate(0, 100, 10, 2); rate != 20 {
+		t.Error("rate should be 20 after 2 seconds, got", rate)
+	}
+	if rate := rampRate(0, 100, 10, 20); rate != 100 {
+		t.Error("rate shouldn't exceed the target, got", rate)
+	}
+	if rate := rampRate(100, 50, 10, 2); rate != 80 {
+		t.Error("rate should ramp down to 80, got", rate)
+	}
+	if rate := rampRate(100, 50, 10, 20); rate != 50 {
+		t.Error("rate shouldn't go below the target, got", rate)
+	}
+}
+
+func newArrivalRunner(config Config, fn func()) *runner {
+	stats := newRequestStats(time.Microsecond)
+	stats.start()
+	config.HeartbeatInterval = 0
+	config.Executor = ExecutorArrivalRate
+	r := newRunner([]*Task{{Name: "foo", Weight: 1, Fn: fn}}, stats, config)
+	r.getReady()
+	return r
+}
+
+func TestArrivalRate(t *testing.T) {
+	for _, distribution := range []string{ArrivalConstant, ArrivalPoisson} {
+		var iterations int64
+		config := DefaultConfig()
+		config.ArrivalDistribution = distribution
+		r := newArrivalRunner(config, func() {
+			atomic.AddInt64(&iterations, 1)
+			time.Sleep(20 * time.Millisecond)
+		})
+
+		r.startHatching(100, 10000)
+		time.Sleep(500 * time.Millisecond)
+		r.stop()
+		r.close()
+		r.stats.close()
+
+		// the rate doesn't depend on how long iterations take
+		if n := atomic.LoadInt64(&iterations); n < 25 || n > 75 {
+			t.Errorf("about 50 iterations should be started in %s, got %d", distribution, n)
+		}
+		if n := atomic.LoadInt32(&r.numClients); n != 0 {
+			t.Error("all the workers should be stopped, got", n)
+		}
+	}
+}
+
+func TestDroppedIterations(t *testing.T) {
+	var iterations int64
+	config := DefaultConfig()
+	config.MaxWorkers = 1
+	r := newArrivalRunner(config, func() {
+		atomic.AddInt64(&iterations, 1)
+		time.Sleep(100 * time.Millisecond)
+	})
+	defer r.stats.close()
+	defer r.close()
+	output := newConsoleOutput(ioutil.Discard)
+	r.outputs = []Output{output}
+
+	r.startHatching(100, 10000)
+	time.Sleep(300 * time.Millisecond)
+	r.stop()
+
+	if n := atomic.LoadInt64(&iterations); n > 4 {
+		t.Error("only one worker should run iterations, got", n)
+	}
+	if dropped := output.entries.droppedIterations; dropped < 10 {
+		t.Error("iterations should be dropped when all the workers are busy, got", dropped)
+	}
+	if total := output.entries.total; total.numFailures != 0 {
+		t.Error("dropped iterations aren't failures, got", total.numFailures)
+	}
+}
+
+func TestArrivalIterations(t *testing.T) {
+	var iterations int64
+	config := DefaultConfig()
+	config.Iterations = 10
+	r := newArrivalRunner(config, func() { atomic.AddInt64(&iterations, 1) })
+	defer r.stats.close()
+	defer r.close()
+
+	r.startHatching(200, 10000)
+	waitForFinish(t, r)
+	if n := atomic.LoadInt64(&iterations); n != 10 {
+		t.Error("10 iterations should be started, got", n)
+	}
+}
+
+func TestIdleWorkersExit(t *testing.T) {
+	r := newArrivalRunner(DefaultConfig(), func() { time.Sleep(20 * time.Millisecond) })
+	defer r.stats.close()
+	defer r.close()
+	r.arrivalIdleTimeout = 50 * time.Millisecond
+
+	r.startHatching(200, 10000)
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&r.numClients) > 1 })
+	// the rate drops to one iteration per second, the workers are idle
+	r.startHatching(1, 10000)
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&r.numClients) <= 1 })
+	r.stop()
+}
@@ -0,0 +1,154 @@
+package boomer
+
+import (
+	"math/bits"
+	"time"
+)
+
+// histogramSubBucketBits decides the precision of histogram, values are
+// recorded with a relative error below 1/2^(histogramSubBucketBits-1), that's 1%.
+const histogramSubBucketBits = 8
+
+const (
+	histogramSubBucketCount     = 1 << histogramSubBucketBits
+	histogramSubBucketHalfCount = histogramSubBucketCount / 2
+)
+
+// histogram records response times like HdrHistogram does. Values below
+// histogramSubBucketCount units are recorded exactly, larger values share
+// a bucket with their neighbours within the relative error.
+type histogram struct {
+	// unit is the precision of histogram, e.g. time.Microsecond
+	unit   time.Duration
+	counts []int64
+	count  int64
+}
+
+func newHistogram(unit time.Duration) *histogram {
+	if unit <= 0 {
+		unit = time.Nanosecond
+	}
+	return &histogram{
+		unit:   unit,
+		counts: make([]int64, histogramSubBucketCount),
+	}
+}
+
+func (h *histogram) index(value int64) int {
+	if value < histogramSubBucketCount {
+		return int(value)
+	}
+	shift := bits.Len64(uint64(value)) - histogramSubBucketBits
+	return shift*histogramSubBucketHalfCount + int(value>>uint(shift))
+}
+
+// lowestValueAt and highestValueAt return the range of values recorded at index.
+func (h *histogram) lowestValueAt(index int) int64 {
+	if index < histogramSubBucketCount {
+		return int64(index)
+	}
+	shift := index/histogramSubBucketHalfCount - 1
+	return int64(index-shift*histogramSubBucketHalfCount) << uint(shift)
+}
+
+func (h *histogram) highestValueAt(index int) int64 {
+	if index < histogramSubBucketCount {
+		return int64(index)
+	}
+	shift := index/histogramSubBucketHalfCount - 1
+	return h.lowestValueAt(index) + 1<<uint(shift) - 1
+}
+
+func (h *histogram) record(responseTime time.Duration) {
+	value := int64(responseTime / h.unit)
+	if value < 0 {
+		value = 0
+	}
+	index := h.index(value)
+	if index >= len(h.counts) {
+		counts := make([]int64, index+histogramSubBucketHalfCount)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[index]++
+	h.count++
+}
+
+// merge adds the values recorded by other, both of them must have the same unit.
+func (h *histogram) merge(other *histogram) {
+	if len(other.counts) > len(h.counts) {
+		counts := make([]int64, len(other.counts))
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.count += other.count
+}
+
+// copy returns a histogram with the same values, which isn't changed by h.
+func (h *histogram) copy() *histogram {
+	counts := make([]int64, len(h.counts))
+	copy(counts, h.counts)
+	return &histogram{
+		unit:   h.unit,
+		counts: counts,
+		count:  h.count,
+	}
+}
+
+func (h *histogram) reset() {
+	for i := range h.counts {
+		h.counts[i] = 0
+	}
+	h.count = 0
+}
+
+// percentile returns the response time that percent of the values are not greater than,
+// percent is between 0 and 100.
+func (h *histogram) percentile(percent float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	target := int64(float64(h.count)*percent/100 + 0.5)
+	if target < 1 {
+		target = 1
+	}
+	seen := int64(0)
+	for i, c := range h.counts {
+		seen += c
+		if seen >= target {
+			return time.Duration(h.highestValueAt(i)) * h.unit
+		}
+	}
+	return time.Duration(h.highestValueAt(len(h.counts)-1)) * h.unit
+}
+
+// locustResponseTimes converts the histogram to the response_times of locust,
+// the keys are milliseconds rounded by roundResponseTime.
+func (h *histogram) locustResponseTimes() map[int64]int64 {
+	responseTimes := make(map[int64]int64)
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		middle := (h.lowestValueAt(i) + h.highestValueAt(i)) / 2
+		milliseconds := round(float64(time.Duration(middle)*h.unit)/float64(time.Millisecond), .5, 0)
+		responseTimes[roundResponseTime(int64(milliseconds))] += c
+	}
+	return responseTimes
+}
+
+// roundResponseTime saves the response time rounded, so that 147 becomes 150,
+// 3432 becomes 3400 and 58760 becomes 59000, see also locust's stats.py
+func roundResponseTime(responseTime int64) int64 {
+	if responseTime < 100 {
+		return responseTime
+	} else if responseTime < 1000 {
+		return int64(round(float64(responseTime), .5, -1))
+	} else if responseTime < 10000 {
+		return int64(round(float64(responseTime), .5, -2))
+	}
+	return int64(round(float64(responseTime), .5, -3))
+}
@@ -0,0 +1,67 @@
+package boomer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogramIndex(t *testing.T) {
+	h := newHistogram(time.Microsecond)
+	for _, value := range []int64{0, 1, 255, 256, 257, 1000, 123456, 1 << 40} {
+		index := h.index(value)
+		if value < h.lowestValueAt(index) || value > h.highestValueAt(index) {
+			t.Error(value, "is out of its bucket", h.lowestValueAt(index), h.highestValueAt(index))
+		}
+		if relErr := float64(h.highestValueAt(index)-h.lowestValueAt(index)) / float64(value+1); relErr > 0.01 {
+			t.Error("relative error of", value, "is", relErr)
+		}
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	h := newHistogram(time.Microsecond)
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * 10 * time.Microsecond)
+	}
+
+	expected := map[float64]time.Duration{
+		50:   5 * time.Millisecond,
+		90:   9 * time.Millisecond,
+		99.9: 9990 * time.Microsecond,
+	}
+	for percent, value := range expected {
+		p := h.percentile(percent)
+		if p < value || float64(p-value) > float64(value)*0.01 {
+			t.Error("wrong percentile", percent, p, value)
+		}
+	}
+
+	h.reset()
+	if h.percentile(99) != 0 {
+		t.Error("histogram is not reset")
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a := newHistogram(time.Microsecond)
+	b := newHistogram(time.Microsecond)
+	a.record(time.Millisecond)
+	b.record(time.Second)
+	a.merge(b)
+	if a.count != 2 || a.percentile(100) < time.Second {
+		t.Error("wrong merged histogram", a.count, a.percentile(100))
+	}
+}
+
+func TestLocustResponseTimes(t *testing.T) {
+	h := newHistogram(time.Microsecond)
+	h.record(300 * time.Microsecond)
+	h.record(147 * time.Millisecond)
+	h.record(3432 * time.Millisecond)
+	h.record(3480 * time.Millisecond)
+
+	responseTimes := h.locustResponseTimes()
+	if responseTimes[0] != 1 || responseTimes[150] != 1 || responseTimes[3400] != 1 || responseTimes[3500] != 1 {
+		t.Error("wrong response times", responseTimes)
+	}
+}
@@ -0,0 +1,11 @@
+package master
+
+import (
+	"errors"
+)
+
+var (
+	errUnknownRPC = errors.New("unknown rpc type, choose zeromq or socket")
+	errNoWorkers  = errors.New("no workers connected")
+	errShutdown   = errors.New("master has quit")
+)
@@ -0,0 +1,330 @@
+// Package master implements a locust compatible master, so boomer workers
+// can run a distributed load test without python.
+package master
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	stateInit     = "ready"
+	stateHatching = "hatching"
+	stateRunning  = "running"
+	stateStopped  = "stopped"
+	stateMissing  = "missing"
+)
+
+const (
+	heartbeatInterval = 1 * time.Second
+	// workers are missing after 3 heartbeats are missed, the same as locust
+	heartbeatLiveness = 3 * heartbeatInterval
+)
+
+type worker struct {
+	nodeID        string
+	state         string
+	userCount     int64
+	cpuUsage      float64
+	lastHeartbeat time.Time
+}
+
+// Master tracks the connected workers, tells them to hatch or stop,
+// and aggregates the stats they report.
+type Master struct {
+	server          server
+	fromWorker      chan *message
+	toWorker        chan *message
+	shutdownChannel chan bool
+
+	mutex      sync.Mutex
+	state      string
+	workers    map[string]*worker
+	numClients int
+	hatchRate  float64
+	stats      *requestStats
+}
+
+// New returns a master that will listen on bindHost:bindPort, rpc is zeromq or socket.
+func New(bindHost string, bindPort int, rpc string) *Master {
+	return &Master{
+		server:          newServer(rpc, bindHost, bindPort),
+		fromWorker:      make(chan *message, 100),
+		toWorker:        make(chan *message, 100),
+		shutdownChannel: make(chan bool),
+		state:           stateInit,
+		workers:         make(map[string]*worker),
+		stats:           newRequestStats(),
+	}
+}
+
+// Run binds the sockets and starts handling messages from workers.
+func (m *Master) Run() error {
+	if m.server == nil {
+		return errUnknownRPC
+	}
+	if err := m.server.bind(m.fromWorker, m.toWorker); err != nil {
+		return err
+	}
+	go m.handleMessages()
+	go m.heartbeat()
+	return nil
+}
+
+// heartbeat tells workers that master is alive, and marks
+// workers that stop sending heartbeats as missing.
+func (m *Master) heartbeat() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.mutex.Lock()
+			if m.isShutdown() {
+				m.mutex.Unlock()
+				return
+			}
+			for nodeID, w := range m.workers {
+				m.toWorker <- newMessage("heartbeat", nil, nodeID)
+				if w.state != stateMissing && !w.lastHeartbeat.IsZero() && time.Since(w.lastHeartbeat) > heartbeatLiveness {
+					log.Printf("Worker %s failed to send heartbeat, setting state to missing.\n", nodeID)
+					w.state = stateMissing
+					w.userCount = 0
+				}
+			}
+			m.mutex.Unlock()
+		case <-m.shutdownChannel:
+			return
+		}
+	}
+}
+
+func (m *Master) handleMessages() {
+	for {
+		select {
+		case msg := <-m.fromWorker:
+			m.onMessage(msg)
+		case <-m.shutdownChannel:
+			return
+		}
+	}
+}
+
+func (m *Master) onMessage(msg *message) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch msg.Type {
+	case "client_ready":
+		m.workers[msg.NodeID] = &worker{
+			nodeID: msg.NodeID,
+			state:  stateInit,
+		}
+		log.Printf("Worker %s reported as ready. Currently %d workers connected.\n", msg.NodeID, len(m.workers))
+		if m.state == stateHatching || m.state == stateRunning {
+			// rebalance the users with the new worker
+			m.hatch()
+		}
+	case "client_stopped":
+		if w, ok := m.workers[msg.NodeID]; ok {
+			w.state = stateStopped
+			w.userCount = 0
+		}
+	case "hatching":
+		if w, ok := m.workers[msg.NodeID]; ok {
+			w.state = stateHatching
+		}
+	case "hatch_complete":
+		if w, ok := m.workers[msg.NodeID]; ok {
+			w.state = stateRunning
+			w.userCount = toInt64(msg.Data["count"])
+		}
+		if m.allWorkersIn(stateRunning) {
+			m.state = stateRunning
+			log.Printf("All %d workers finished hatching, %d users in total.\n", len(m.workers), m.userCount())
+		}
+	case "stats":
+		m.stats.extend(msg.Data)
+		if w, ok := m.workers[msg.NodeID]; ok {
+			w.userCount = toInt64(msg.Data["user_count"])
+		}
+	case "heartbeat":
+		if w, ok := m.workers[msg.NodeID]; ok {
+			if w.state == stateMissing {
+				log.Printf("Worker %s is back.\n", msg.NodeID)
+			}
+			w.state = toString(msg.Data["state"])
+			w.cpuUsage = toFloat64(msg.Data["current_cpu_usage"])
+			w.lastHeartbeat = time.Now()
+			if w.cpuUsage > 90 {
+				log.Printf("Worker %s exceeded cpu threshold (%.1f%%).\n", msg.NodeID, w.cpuUsage)
+			}
+		}
+	case "quit":
+		if _, ok := m.workers[msg.NodeID]; ok {
+			delete(m.workers, msg.NodeID)
+			log.Printf("Worker %s quit. Currently %d workers connected.\n", msg.NodeID, len(m.workers))
+		}
+	}
+}
+
+func (m *Master) allWorkersIn(state string) bool {
+	for _, w := range m.workers {
+		if w.state != state && w.state != stateMissing {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Master) userCount() int64 {
+	count := int64(0)
+	for _, w := range m.workers {
+		count += w.userCount
+	}
+	return count
+}
+
+// Hatch splits numClients and hatchRate across the connected workers,
+// the same as locust does.
+func (m *Master) Hatch(numClients int, hatchRate float64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.isShutdown() {
+		return errShutdown
+	}
+	if len(m.activeWorkers()) == 0 {
+		return errNoWorkers
+	}
+	if m.state != stateHatching && m.state != stateRunning {
+		m.stats = newRequestStats()
+	}
+	m.numClients = numClients
+	m.hatchRate = hatchRate
+	m.hatch()
+	return nil
+}
+
+func (m *Master) activeWorkers() []string {
+	nodeIDs := make([]string, 0, len(m.workers))
+	for nodeID, w := range m.workers {
+		if w.state != stateMissing {
+			nodeIDs = append(nodeIDs, nodeID)
+		}
+	}
+	return nodeIDs
+}
+
+func (m *Master) hatch() {
+	if m.isShutdown() {
+		return
+	}
+	workers := m.activeWorkers()
+	numWorkers := len(workers)
+	if numWorkers == 0 {
+		return
+	}
+	workerNumClients := m.numClients / numWorkers
+	workerHatchRate := m.hatchRate / float64(numWorkers)
+	remaining := m.numClients % numWorkers
+
+	log.Printf("Sending hatch jobs to %d workers\n", numWorkers)
+	m.state = stateHatching
+	for _, nodeID := range workers {
+		data := make(map[string]interface{})
+		data["hatch_rate"] = workerHatchRate
+		data["num_clients"] = int64(workerNumClients)
+		if remaining > 0 {
+			data["num_clients"] = int64(workerNumClients + 1)
+			remaining--
+		}
+		m.toWorker <- newMessage("hatch", data, nodeID)
+	}
+}
+
+// Stop tells all the workers to stop their users.
+func (m *Master) Stop() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.isShutdown() {
+		return
+	}
+	m.state = stateStopped
+	for nodeID := range m.workers {
+		m.toWorker <- newMessage("stop", nil, nodeID)
+	}
+}
+
+// Quit tells all the workers to quit and closes the sockets.
+// Master can't be used after it quits.
+func (m *Master) Quit() {
+	m.mutex.Lock()
+	if m.isShutdown() {
+		m.mutex.Unlock()
+		return
+	}
+	for nodeID := range m.workers {
+		m.toWorker <- newMessage("quit", nil, nodeID)
+	}
+	close(m.shutdownChannel)
+	close(m.toWorker)
+	m.mutex.Unlock()
+
+	m.server.close()
+}
+
+// isShutdown tells whether Quit has closed toWorker, m.mutex must be held.
+func (m *Master) isShutdown() bool {
+	select {
+	case <-m.shutdownChannel:
+		return true
+	default:
+		return false
+	}
+}
+
+// WorkerCount returns the number of connected workers.
+func (m *Master) WorkerCount() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.workers)
+}
+
+// UserCount returns the number of users running on all the workers.
+func (m *Master) UserCount() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.userCount()
+}
+
+// Total returns a copy of the aggregated total stats.
+func (m *Master) Total() StatsEntry {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.stats.total.copy()
+}
+
+// Entries returns a copy of the aggregated stats of each request.
+func (m *Master) Entries() []StatsEntry {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	entries := make([]StatsEntry, 0, len(m.stats.entries))
+	for _, entry := range m.stats.entries {
+		entries = append(entries, entry.copy())
+	}
+	return entries
+}
+
+// Errors returns a copy of the aggregated errors.
+func (m *Master) Errors() []StatsError {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	errors := make([]StatsError, 0, len(m.stats.errors))
+	for _, e := range m.stats.errors {
+		errors = append(errors, *e)
+	}
+	return errors
+}
@@ -0,0 +1,201 @@
+package master
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+type testWorker struct {
+	nodeID string
+	conn   net.Conn
+}
+
+func newTestWorker(t *testing.T, addr string, nodeID string) *testWorker {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testWorker{
+		nodeID: nodeID,
+		conn:   conn,
+	}
+}
+
+func (w *testWorker) send(t *testing.T, msgType string, data map[string]interface{}) {
+	packed, err := newMessage(msgType, data, w.nodeID).serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, int32(len(packed)))
+	buf.Write(packed)
+	w.conn.Write(buf.Bytes())
+}
+
+func (w *testWorker) recv(t *testing.T) *message {
+	w.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(w.conn, header); err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, binary.BigEndian.Uint32(header))
+	if _, err := io.ReadFull(w.conn, body); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := newMessageFromBytes(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	for i := 0; i < 100; i++ {
+		if condition() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout")
+}
+
+func TestHatchIsSplitAcrossWorkers(t *testing.T) {
+	m := New("127.0.0.1", 0, "socket")
+	if err := m.Run(); err != nil {
+		t.Fatal(err)
+	}
+	addr := m.server.(*socketServer).listener.Addr().String()
+
+	if err := m.Hatch(10, 4); err != errNoWorkers {
+		t.Error("hatch should fail without workers")
+	}
+
+	w1 := newTestWorker(t, addr, "w1")
+	w2 := newTestWorker(t, addr, "w2")
+	w1.send(t, "client_ready", nil)
+	w2.send(t, "client_ready", nil)
+	waitFor(t, func() bool { return m.WorkerCount() == 2 })
+
+	if err := m.Hatch(5, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	total := int64(0)
+	for _, w := range []*testWorker{w1, w2} {
+		msg := w.recv(t)
+		if msg.Type != "hatch" {
+			t.Fatalf("unexpected message %s", msg.Type)
+		}
+		if msg.NodeID != w.nodeID {
+			t.Errorf("hatch for %s is sent to %s", msg.NodeID, w.nodeID)
+		}
+		if msg.Data["hatch_rate"].(float64) != 2 {
+			t.Error("hatch rate should be 2, got", msg.Data["hatch_rate"])
+		}
+		total += toInt64(msg.Data["num_clients"])
+	}
+	if total != 5 {
+		t.Error("5 clients should be hatched in total, got", total)
+	}
+
+	w1.send(t, "hatch_complete", map[string]interface{}{"count": 3})
+	w2.send(t, "hatch_complete", map[string]interface{}{"count": 2})
+	waitFor(t, func() bool { return m.UserCount() == 5 })
+
+	w2.conn.Close()
+	waitFor(t, func() bool { return m.WorkerCount() == 1 })
+
+	m.Quit()
+	if msg := w1.recv(t); msg.Type != "quit" {
+		t.Error("worker should receive quit, got", msg.Type)
+	}
+
+	// nothing is sent after quit
+	m.onMessage(newMessage("client_ready", nil, "w3"))
+	m.Stop()
+	if err := m.Hatch(5, 4); err != errShutdown {
+		t.Error("hatch should fail after quit, got", err)
+	}
+	m.Quit()
+}
+
+func TestStatsAreAggregated(t *testing.T) {
+	report := func(numRequests, minResponseTime, maxResponseTime int64) map[string]interface{} {
+		entry := map[string]interface{}{
+			"name":                "foo",
+			"method":              "http",
+			"num_requests":        numRequests,
+			"num_failures":        int64(1),
+			"total_response_time": numRequests * 10,
+			"min_response_time":   minResponseTime,
+			"max_response_time":   maxResponseTime,
+			"response_times":      map[int64]int64{10: numRequests},
+			"num_reqs_per_sec":    map[int64]int64{1500000000: numRequests},
+		}
+		errors := map[string]interface{}{
+			"key": map[string]interface{}{
+				"name":       "foo",
+				"method":     "http",
+				"error":      "timeout",
+				"occurences": int64(1),
+			},
+		}
+		data := map[string]interface{}{
+			"stats":       []interface{}{entry},
+			"stats_total": entry,
+			"errors":      errors,
+		}
+		// go through msgpack like a real worker does
+		packed, _ := newMessage("stats", data, "w").serialize()
+		msg, _ := newMessageFromBytes(packed)
+		return msg.Data
+	}
+
+	s := newRequestStats()
+	s.extend(report(3, 5, 20))
+	s.extend(report(2, 3, 15))
+
+	entry := s.entries["foohttp"]
+	if entry == nil {
+		t.Fatal("entry of foo is missing")
+	}
+	if entry.NumRequests != 5 || entry.NumFailures != 2 {
+		t.Error("wrong number of requests or failures", entry.NumRequests, entry.NumFailures)
+	}
+	if entry.MinResponseTime != 3 || entry.MaxResponseTime != 20 {
+		t.Error("wrong min or max response time", entry.MinResponseTime, entry.MaxResponseTime)
+	}
+	if entry.ResponseTimes[10] != 5 || entry.NumReqsPerSec[1500000000] != 5 {
+		t.Error("response times aren't merged", entry.ResponseTimes, entry.NumReqsPerSec)
+	}
+	if entry.AvgResponseTime() != 10 || entry.Percentile(95) != 10 {
+		t.Error("wrong avg or percentile", entry.AvgResponseTime(), entry.Percentile(95))
+	}
+	if s.total.NumRequests != 5 {
+		t.Error("total isn't aggregated", s.total.NumRequests)
+	}
+	if s.errors["key"].Occurences != 2 {
+		t.Error("errors aren't aggregated", s.errors["key"].Occurences)
+	}
+}
+
+func TestQuitReleasesGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	m := New("127.0.0.1", 0, "socket")
+	if err := m.Run(); err != nil {
+		t.Fatal(err)
+	}
+	addr := m.server.(*socketServer).listener.Addr().String()
+	w := newTestWorker(t, addr, "w1")
+	defer w.conn.Close()
+	w.send(t, "client_ready", nil)
+	waitFor(t, func() bool { return m.WorkerCount() == 1 })
+
+	m.Quit()
+	waitFor(t, func() bool { return runtime.NumGoroutine() <= before })
+}
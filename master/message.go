@@ -0,0 +1,115 @@
+package master
+
+import (
+	"github.com/ugorji/go/codec"
+)
+
+var (
+	mh codec.MsgpackHandle
+)
+
+func init() {
+	// the handle is shared by goroutines, set it up only once
+	mh.StructToArray = true
+}
+
+// message is the same msgpack envelope that boomer and locust use.
+// For messages sent to workers, NodeID is the target worker, an empty
+// NodeID means all the workers.
+type message struct {
+	Type   string
+	Data   map[string]interface{}
+	NodeID string
+}
+
+func newMessage(t string, data map[string]interface{}, nodeID string) (msg *message) {
+	return &message{
+		Type:   t,
+		Data:   data,
+		NodeID: nodeID,
+	}
+}
+
+func (m *message) serialize() (out []byte, err error) {
+	enc := codec.NewEncoderBytes(&out, &mh)
+	err = enc.Encode(m)
+	return out, err
+}
+
+func newMessageFromBytes(raw []byte) (*message, error) {
+	dec := codec.NewDecoderBytes(raw, &mh)
+	var newMsg = &message{}
+	err := dec.Decode(newMsg)
+	if err != nil {
+		return nil, err
+	}
+	return newMsg, nil
+}
+
+// msgpack decodes strings as []byte and nested maps as map[interface{}]interface{},
+// the helpers below convert them back.
+
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	}
+	return ""
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case uint64:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+func toFloat64(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case float32:
+		return float64(n)
+	}
+	return float64(toInt64(v))
+}
+
+func toMap(v interface{}) map[string]interface{} {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			result[toString(k)] = v
+		}
+		return result
+	}
+	return nil
+}
+
+func toInt64Map(v interface{}) map[int64]int64 {
+	result := make(map[int64]int64)
+	switch m := v.(type) {
+	case map[interface{}]interface{}:
+		for k, v := range m {
+			result[toInt64(k)] = toInt64(v)
+		}
+	case map[int64]int64:
+		for k, v := range m {
+			result[k] = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,20 @@
+package master
+
+type server interface {
+	// bind starts listening, messages from workers are sent to fromWorker,
+	// messages sent to toWorker are delivered to workers.
+	bind(fromWorker chan<- *message, toWorker <-chan *message) error
+	// close waits until toWorker is closed and drained, then closes the sockets.
+	// Nothing is sent to fromWorker after close.
+	close()
+}
+
+func newServer(rpc string, bindHost string, bindPort int) server {
+	switch rpc {
+	case "zeromq":
+		return newZmqServer(bindHost, bindPort)
+	case "socket":
+		return newSocketServer(bindHost, bindPort)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// +build goczmq
+
+package master
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/zeromq/goczmq"
+)
+
+// zmqServer binds the same push/pull pair as locust's master.
+// Messages sent with push are load balanced between workers,
+// so NodeID can't be used to choose the receiver.
+type zmqServer struct {
+	bindHost string
+	bindPort int
+	pushConn *goczmq.Sock
+	pullConn *goczmq.Sock
+	sent     chan bool
+	// closed stops recv, which destroys pullConn, sockets can't be shared between goroutines
+	closed chan bool
+}
+
+func newZmqServer(bindHost string, bindPort int) server {
+	return &zmqServer{
+		bindHost: bindHost,
+		bindPort: bindPort,
+		sent:     make(chan bool),
+		closed:   make(chan bool),
+	}
+}
+
+func (s *zmqServer) bind(fromWorker chan<- *message, toWorker <-chan *message) error {
+	pullConn, err := goczmq.NewPull(fmt.Sprintf("@tcp://%s:%d", s.bindHost, s.bindPort))
+	if err != nil {
+		return err
+	}
+	pushConn, err := goczmq.NewPush(fmt.Sprintf("@tcp://%s:%d", s.bindHost, s.bindPort+1))
+	if err != nil {
+		pullConn.Destroy()
+		return err
+	}
+	// RecvFrame returns every second, so recv notices close
+	pullConn.SetRcvtimeo(1000)
+	s.pullConn = pullConn
+	s.pushConn = pushConn
+	go s.recv(fromWorker)
+	go s.send(toWorker)
+	return nil
+}
+
+func (s *zmqServer) close() {
+	// wait until the pending messages are sent
+	<-s.sent
+	close(s.closed)
+	s.pushConn.Destroy()
+}
+
+func (s *zmqServer) recv(fromWorker chan<- *message) {
+	defer s.pullConn.Destroy()
+	for {
+		raw, _, err := s.pullConn.RecvFrame()
+		select {
+		case <-s.closed:
+			return
+		default:
+		}
+		if err != nil {
+			// RecvFrame has timed out
+			continue
+		}
+		msg, err := newMessageFromBytes(raw)
+		if err != nil {
+			log.Printf("Invalid message, %v\n", err)
+			continue
+		}
+		select {
+		case fromWorker <- msg:
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+func (s *zmqServer) send(toWorker <-chan *message) {
+	for msg := range toWorker {
+		packed, err := msg.serialize()
+		if err != nil {
+			log.Printf("Failed to serialize message, %v\n", err)
+			continue
+		}
+		s.pushConn.SendFrame(packed, 0)
+	}
+	close(s.sent)
+}
@@ -0,0 +1,22 @@
+// +build !goczmq
+
+package master
+
+import (
+	"errors"
+)
+
+// Binding zeromq sockets is only implemented with goczmq.
+type zmqServer struct {
+}
+
+func newZmqServer(bindHost string, bindPort int) server {
+	return &zmqServer{}
+}
+
+func (s *zmqServer) bind(fromWorker chan<- *message, toWorker <-chan *message) error {
+	return errors.New("zeromq is not supported by this build of master, build with -tags goczmq or use socket")
+}
+
+func (s *zmqServer) close() {
+}
@@ -0,0 +1,150 @@
+package master
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+// socketServer speaks the length-prefixed protocol of boomer's socket client.
+type socketServer struct {
+	bindHost string
+	bindPort int
+	listener net.Listener
+	sent     chan bool
+	// closed releases the goroutines that are sending to fromWorker
+	closed chan bool
+
+	mutex sync.Mutex
+	conns map[string]net.Conn
+}
+
+func newSocketServer(bindHost string, bindPort int) *socketServer {
+	return &socketServer{
+		bindHost: bindHost,
+		bindPort: bindPort,
+		conns:    make(map[string]net.Conn),
+		sent:     make(chan bool),
+		closed:   make(chan bool),
+	}
+}
+
+func (s *socketServer) bind(fromWorker chan<- *message, toWorker <-chan *message) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", s.bindHost, s.bindPort))
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	go s.accept(fromWorker)
+	go s.send(toWorker)
+	return nil
+}
+
+func (s *socketServer) close() {
+	// wait until the pending messages are sent
+	<-s.sent
+	close(s.closed)
+	s.listener.Close()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *socketServer) accept(fromWorker chan<- *message) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.recv(conn, fromWorker)
+	}
+}
+
+func (s *socketServer) recv(conn net.Conn, fromWorker chan<- *message) {
+	nodeID := ""
+	defer func() {
+		conn.Close()
+		if nodeID == "" {
+			return
+		}
+		s.mutex.Lock()
+		if s.conns[nodeID] == conn {
+			delete(s.conns, nodeID)
+		}
+		s.mutex.Unlock()
+		// the worker is gone without saying goodbye
+		s.deliver(fromWorker, newMessage("quit", nil, nodeID))
+	}()
+
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		msg, err := newMessageFromBytes(body)
+		if err != nil {
+			log.Printf("Invalid message from %s, %v\n", conn.RemoteAddr(), err)
+			continue
+		}
+		if nodeID == "" {
+			nodeID = msg.NodeID
+			s.mutex.Lock()
+			s.conns[nodeID] = conn
+			s.mutex.Unlock()
+		}
+		if !s.deliver(fromWorker, msg) {
+			return
+		}
+		if msg.Type == "quit" {
+			nodeID = ""
+			s.mutex.Lock()
+			delete(s.conns, msg.NodeID)
+			s.mutex.Unlock()
+			return
+		}
+	}
+}
+
+// deliver sends msg to fromWorker, it returns false if the server is closed.
+func (s *socketServer) deliver(fromWorker chan<- *message, msg *message) bool {
+	select {
+	case fromWorker <- msg:
+		return true
+	case <-s.closed:
+		return false
+	}
+}
+
+func (s *socketServer) send(toWorker <-chan *message) {
+	for msg := range toWorker {
+		packed, err := msg.serialize()
+		if err != nil {
+			log.Printf("Failed to serialize message, %v\n", err)
+			continue
+		}
+		buf := new(bytes.Buffer)
+		binary.Write(buf, binary.BigEndian, int32(len(packed)))
+		buf.Write(packed)
+
+		s.mutex.Lock()
+		for nodeID, conn := range s.conns {
+			if msg.NodeID == "" || msg.NodeID == nodeID {
+				if _, err := conn.Write(buf.Bytes()); err != nil {
+					log.Printf("Error sending to %s: %v\n", nodeID, err)
+				}
+			}
+		}
+		s.mutex.Unlock()
+	}
+	close(s.sent)
+}
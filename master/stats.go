@@ -0,0 +1,153 @@
+package master
+
+import (
+	"sort"
+)
+
+// StatsEntry holds the stats of one request name and method,
+// aggregated from all the workers.
+type StatsEntry struct {
+	Name        string
+	Method      string
+	NumRequests int64
+	NumFailures int64
+	// response times are in milliseconds, with fractions sent by workers
+	TotalResponseTime  float64
+	MinResponseTime    float64
+	MaxResponseTime    float64
+	TotalContentLength int64
+	ResponseTimes      map[int64]int64
+	NumReqsPerSec      map[int64]int64
+}
+
+func newStatsEntry(name, method string) *StatsEntry {
+	return &StatsEntry{
+		Name:          name,
+		Method:        method,
+		ResponseTimes: make(map[int64]int64),
+		NumReqsPerSec: make(map[int64]int64),
+	}
+}
+
+// extend merges a serialized statsEntry sent by a worker.
+func (s *StatsEntry) extend(data map[string]interface{}) {
+	numRequests := toInt64(data["num_requests"])
+	minResponseTime := toFloat64(data["min_response_time"])
+
+	if numRequests > 0 && (s.NumRequests == 0 || minResponseTime < s.MinResponseTime) {
+		s.MinResponseTime = minResponseTime
+	}
+	if maxResponseTime := toFloat64(data["max_response_time"]); maxResponseTime > s.MaxResponseTime {
+		s.MaxResponseTime = maxResponseTime
+	}
+
+	s.NumRequests += numRequests
+	s.NumFailures += toInt64(data["num_failures"])
+	s.TotalResponseTime += toFloat64(data["total_response_time"])
+	s.TotalContentLength += toInt64(data["total_content_length"])
+
+	for k, v := range toInt64Map(data["response_times"]) {
+		s.ResponseTimes[k] += v
+	}
+	for k, v := range toInt64Map(data["num_reqs_per_sec"]) {
+		s.NumReqsPerSec[k] += v
+	}
+}
+
+func (s *StatsEntry) copy() StatsEntry {
+	c := *s
+	c.ResponseTimes = make(map[int64]int64, len(s.ResponseTimes))
+	for k, v := range s.ResponseTimes {
+		c.ResponseTimes[k] = v
+	}
+	c.NumReqsPerSec = make(map[int64]int64, len(s.NumReqsPerSec))
+	for k, v := range s.NumReqsPerSec {
+		c.NumReqsPerSec[k] = v
+	}
+	return c
+}
+
+// AvgResponseTime returns the average response time in milliseconds.
+func (s *StatsEntry) AvgResponseTime() float64 {
+	if s.NumRequests == 0 {
+		return 0
+	}
+	return s.TotalResponseTime / float64(s.NumRequests)
+}
+
+// Percentile returns the response time that percent of the requests are faster than,
+// percent is between 0 and 100, the same as boomer's.
+func (s *StatsEntry) Percentile(percent float64) int64 {
+	if s.NumRequests == 0 {
+		return 0
+	}
+	responseTimes := make([]int64, 0, len(s.ResponseTimes))
+	for k := range s.ResponseTimes {
+		responseTimes = append(responseTimes, k)
+	}
+	sort.Slice(responseTimes, func(i, j int) bool { return responseTimes[i] < responseTimes[j] })
+
+	target := int64(float64(s.NumRequests) * percent / 100)
+	processed := int64(0)
+	for _, responseTime := range responseTimes {
+		processed += s.ResponseTimes[responseTime]
+		if processed >= target {
+			return responseTime
+		}
+	}
+	return int64(s.MaxResponseTime)
+}
+
+// StatsError counts the occurences of an error.
+type StatsError struct {
+	Name       string
+	Method     string
+	Error      string
+	Occurences int64
+}
+
+type requestStats struct {
+	entries map[string]*StatsEntry
+	errors  map[string]*StatsError
+	total   *StatsEntry
+}
+
+func newRequestStats() *requestStats {
+	return &requestStats{
+		entries: make(map[string]*StatsEntry),
+		errors:  make(map[string]*StatsError),
+		total:   newStatsEntry("Total", ""),
+	}
+}
+
+// extend merges the payload of a stats message.
+func (s *requestStats) extend(data map[string]interface{}) {
+	if entries, ok := data["stats"].([]interface{}); ok {
+		for _, v := range entries {
+			entry := toMap(v)
+			name := toString(entry["name"])
+			method := toString(entry["method"])
+			key := name + method
+			if _, ok := s.entries[key]; !ok {
+				s.entries[key] = newStatsEntry(name, method)
+			}
+			s.entries[key].extend(entry)
+		}
+	}
+
+	if total := toMap(data["stats_total"]); total != nil {
+		s.total.extend(total)
+	}
+
+	for key, v := range toMap(data["errors"]) {
+		e := toMap(v)
+		if _, ok := s.errors[key]; !ok {
+			s.errors[key] = &StatsError{
+				Name:   toString(e["name"]),
+				Method: toString(e["method"]),
+				Error:  toString(e["error"]),
+			}
+		}
+		s.errors[key].Occurences += toInt64(e["occurences"])
+	}
+}
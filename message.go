@@ -10,10 +10,19 @@ var (
 	mh codec.MsgpackHandle
 )
 
+func init() {
+	// the handle is shared by goroutines, set it up only once
+	mh.StructToArray = true
+}
+
 type message struct {
-	Type   string                 `codec: "type"`
-	Data   map[string]interface{} `codec: "data"`
-	NodeID string                 `codec: "node_id"`
+	Type   string                 `codec:"type"`
+	Data   map[string]interface{} `codec:"data"`
+	NodeID string                 `codec:"node_id"`
+
+	// rawData is sent instead of Data if it's not nil,
+	// some messages of locust 2.x carry a plain value.
+	rawData interface{}
 }
 
 func newMessage(t string, data map[string]interface{}, nodeID string) (msg *message) {
@@ -25,9 +34,13 @@ func newMessage(t string, data map[string]interface{}, nodeID string) (msg *mess
 }
 
 func (m *message) serialize() (out []byte) {
-	mh.StructToArray = true
 	enc := codec.NewEncoderBytes(&out, &mh)
-	err := enc.Encode(m)
+	var err error
+	if m.rawData != nil {
+		err = enc.Encode([]interface{}{m.Type, m.rawData, m.NodeID})
+	} else {
+		err = enc.Encode(m)
+	}
 	if err != nil {
 		log.Fatal("[msgpack] encode fail")
 	}
@@ -35,7 +48,6 @@ func (m *message) serialize() (out []byte) {
 }
 
 func newMessageFromBytes(raw []byte) *message {
-	mh.StructToArray = true
 	dec := codec.NewDecoderBytes(raw, &mh)
 	var newMsg = &message{}
 	err := dec.Decode(newMsg)
@@ -44,3 +56,42 @@ func newMessageFromBytes(raw []byte) *message {
 	}
 	return newMsg
 }
+
+// msgpack decodes strings as []byte and integers as int64 or uint64,
+// the helpers below convert them back.
+
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	}
+	return ""
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case uint64:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+func toFloat64(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case float32:
+		return float64(n)
+	}
+	return float64(toInt64(v))
+}
@@ -0,0 +1,211 @@
+package boomer
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Output receives the aggregated stats that are reported to master, so results
+// can be kept in the console, files or metrics systems at the same time.
+//
+// Methods of an Output are never called at the same time, a slow Output
+// delays reports to master.
+type Output interface {
+	// OnStart is called when users start hatching.
+	OnStart()
+
+	// OnEvent is called every report interval with the same report that is sent to master.
+	// Response times are in milliseconds, see statsEntry.serialize for the fields of entries.
+	//
+	//	{
+	//		"stats":       []interface{}{map[string]interface{}{"name": ..., "method": ..., ...}, ...},
+	//		"stats_total": map[string]interface{}{...},
+	//		"errors":      map[string]map[string]interface{}{...},
+	//		"user_count":  int32,
+	//	}
+	//
+	// When users are stopped by the limits of AbortFailureRatio or AbortP95, the last report
+	// holds "abort_reason" as a string. With ExecutorArrivalRate, reports hold "dropped_iterations"
+	// as an int64, the iterations dropped since last report.
+	//
+	// Entries are deltas since last report, except "percentiles", which holds
+	// map[string]int64{"p50": ..., "p99.9": ...} in nanoseconds since users start hatching.
+	// "response_times" are rounded to milliseconds like locust does, the exact ones are
+	// in "histogram", which isn't sent to master.
+	//
+	// The report is shared by all the outputs, it must not be changed.
+	OnEvent(data map[string]interface{})
+
+	// OnStop is called when users are stopped.
+	OnStop()
+}
+
+// outputEntry accumulates the entries of reports, which are deltas since last report.
+type outputEntry struct {
+	method             string
+	name               string
+	numRequests        int64
+	numFailures        int64
+	totalContentLength int64
+	// response times are in milliseconds
+	totalResponseTime float64
+	minResponseTime   float64
+	maxResponseTime   float64
+	// lastRequests and lastFailures are the numbers in the last report
+	lastRequests int64
+	lastFailures int64
+	// percentiles are in nanoseconds, since users start hatching
+	percentiles map[string]int64
+}
+
+func newOutputEntry(method, name string) *outputEntry {
+	return &outputEntry{
+		method:      method,
+		name:        name,
+		percentiles: make(map[string]int64),
+	}
+}
+
+func (e *outputEntry) extend(data map[string]interface{}) {
+	numRequests := toInt64(data["num_requests"])
+	if numRequests > 0 {
+		minResponseTime := toFloat64(data["min_response_time"])
+		if e.numRequests == 0 || minResponseTime < e.minResponseTime {
+			e.minResponseTime = minResponseTime
+		}
+		if maxResponseTime := toFloat64(data["max_response_time"]); maxResponseTime > e.maxResponseTime {
+			e.maxResponseTime = maxResponseTime
+		}
+	}
+	e.numRequests += numRequests
+	e.lastRequests = numRequests
+	e.lastFailures = toInt64(data["num_failures"])
+	e.numFailures += e.lastFailures
+	e.totalContentLength += toInt64(data["total_content_length"])
+	e.totalResponseTime += toFloat64(data["total_response_time"])
+	if percentiles, ok := data["percentiles"].(map[string]int64); ok {
+		e.percentiles = percentiles
+	}
+}
+
+func (e *outputEntry) avgResponseTime() float64 {
+	if e.numRequests == 0 {
+		return 0
+	}
+	return e.totalResponseTime / float64(e.numRequests)
+}
+
+func (e *outputEntry) avgContentLength() int64 {
+	if e.numRequests == 0 {
+		return 0
+	}
+	return e.totalContentLength / e.numRequests
+}
+
+// percentile returns the percentile in milliseconds.
+func (e *outputEntry) percentile(percent float64) float64 {
+	return toMilliseconds(time.Duration(e.percentiles[fmt.Sprintf("p%g", percent)]))
+}
+
+// outputError accumulates the occurrences of an error.
+type outputError struct {
+	method      string
+	name        string
+	error       string
+	occurrences int64
+}
+
+// outputEntries accumulates the entries and errors of reports by method and name.
+type outputEntries struct {
+	entries   map[string]*outputEntry
+	errors    map[string]*outputError
+	total     *outputEntry
+	startTime time.Time
+	// droppedIterations are the iterations dropped by the arrival rate executor
+	droppedIterations int64
+}
+
+func newOutputEntries() *outputEntries {
+	return &outputEntries{
+		entries:   make(map[string]*outputEntry),
+		errors:    make(map[string]*outputError),
+		total:     newOutputEntry("", "Total"),
+		startTime: time.Now(),
+	}
+}
+
+func (o *outputEntries) extend(data map[string]interface{}) {
+	// entries that are missing in the report have no requests in the last interval
+	for _, e := range o.entries {
+		e.lastRequests = 0
+		e.lastFailures = 0
+	}
+	entries, _ := data["stats"].([]interface{})
+	for _, v := range entries {
+		entry := v.(map[string]interface{})
+		method, name := toString(entry["method"]), toString(entry["name"])
+		e, ok := o.entries[name+method]
+		if !ok {
+			e = newOutputEntry(method, name)
+			o.entries[name+method] = e
+		}
+		e.extend(entry)
+	}
+	if total, ok := data["stats_total"].(map[string]interface{}); ok {
+		o.total.extend(total)
+	}
+	o.droppedIterations += toInt64(data["dropped_iterations"])
+
+	errors, _ := data["errors"].(map[string]map[string]interface{})
+	for key, e := range errors {
+		err, ok := o.errors[key]
+		if !ok {
+			err = &outputError{
+				method: toString(e["method"]),
+				name:   toString(e["name"]),
+				error:  toString(e["error"]),
+			}
+			o.errors[key] = err
+		}
+		err.occurrences += toInt64(e["occurences"])
+	}
+}
+
+// elapsed returns the seconds since the first report is expected.
+func (o *outputEntries) elapsed() float64 {
+	return time.Since(o.startTime).Seconds()
+}
+
+// sorted returns the entries sorted by name and method.
+func (o *outputEntries) sorted() []*outputEntry {
+	entries := make([]*outputEntry, 0, len(o.entries))
+	for _, e := range o.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].name != entries[j].name {
+			return entries[i].name < entries[j].name
+		}
+		return entries[i].method < entries[j].method
+	})
+	return entries
+}
+
+// sortedErrors returns the errors sorted by name, method and error.
+func (o *outputEntries) sortedErrors() []*outputError {
+	errors := make([]*outputError, 0, len(o.errors))
+	for _, e := range o.errors {
+		errors = append(errors, e)
+	}
+	sort.Slice(errors, func(i, j int) bool {
+		if errors[i].name != errors[j].name {
+			return errors[i].name < errors[j].name
+		}
+		if errors[i].method != errors[j].method {
+			return errors[i].method < errors[j].method
+		}
+		return errors[i].error < errors[j].error
+	})
+	return errors
+}
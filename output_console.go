@@ -0,0 +1,99 @@
+package boomer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+)
+
+// ConsoleOutput prints a table of the stats since users start hatching every report interval,
+// and the totals when users are stopped.
+type ConsoleOutput struct {
+	writer io.Writer
+
+	mutex     sync.Mutex
+	entries   *outputEntries
+	userCount int64
+}
+
+// NewConsoleOutput returns a ConsoleOutput that prints to stdout.
+func NewConsoleOutput() *ConsoleOutput {
+	return newConsoleOutput(os.Stdout)
+}
+
+func newConsoleOutput(writer io.Writer) *ConsoleOutput {
+	return &ConsoleOutput{
+		writer:  writer,
+		entries: newOutputEntries(),
+	}
+}
+
+// OnStart implements Output.
+func (o *ConsoleOutput) OnStart() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.entries = newOutputEntries()
+}
+
+// OnEvent implements Output.
+func (o *ConsoleOutput) OnEvent(data map[string]interface{}) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.entries.extend(data)
+	o.userCount = toInt64(data["user_count"])
+
+	if reason, ok := data["abort_reason"].(string); ok {
+		fmt.Fprintf(o.writer, "\nAborted, %s\n", reason)
+	}
+	fmt.Fprintf(o.writer, "\nUsers: %d\n", o.userCount)
+	o.printDroppedIterations()
+	// req/s is the current rate
+	o.printTable(func(e *outputEntry) float64 {
+		return float64(e.lastRequests) / slaveReportInterval.Seconds()
+	})
+}
+
+// OnStop implements Output.
+func (o *ConsoleOutput) OnStop() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.entries.total.numRequests == 0 && o.entries.total.numFailures == 0 {
+		return
+	}
+	fmt.Fprintln(o.writer, "\nTotals:")
+	// req/s is the average rate
+	elapsed := o.entries.elapsed()
+	o.printTable(func(e *outputEntry) float64 {
+		return float64(e.numRequests) / elapsed
+	})
+	o.printDroppedIterations()
+}
+
+func (o *ConsoleOutput) printDroppedIterations() {
+	if o.entries.droppedIterations > 0 {
+		fmt.Fprintf(o.writer, "Dropped iterations: %d\n", o.entries.droppedIterations)
+	}
+}
+
+func (o *ConsoleOutput) printTable(rps func(e *outputEntry) float64) {
+	w := tabwriter.NewWriter(o.writer, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Type\tName\t# reqs\t# fails\treq/s\tmin(ms)\tavg(ms)\tmax(ms)\tp50(ms)\tp90(ms)\tp99(ms)\tavg size(bytes)\t")
+	for _, e := range o.entries.sorted() {
+		printConsoleEntry(w, e, rps(e))
+	}
+	printConsoleEntry(w, o.entries.total, rps(o.entries.total))
+	w.Flush()
+}
+
+func printConsoleEntry(w io.Writer, e *outputEntry, rps float64) {
+	failureRatio := float64(0)
+	if e.numRequests+e.numFailures > 0 {
+		failureRatio = float64(e.numFailures) / float64(e.numRequests+e.numFailures) * 100
+	}
+	fmt.Fprintf(w, "%s\t%s\t%d\t%d(%.2f%%)\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%d\t\n",
+		e.method, e.name, e.numRequests, e.numFailures, failureRatio, rps,
+		e.minResponseTime, e.avgResponseTime(), e.maxResponseTime,
+		e.percentile(50), e.percentile(90), e.percentile(99), e.avgContentLength())
+}
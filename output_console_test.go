@@ -0,0 +1,48 @@
+package boomer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsoleOutput(t *testing.T) {
+	buf := new(bytes.Buffer)
+	o := newConsoleOutput(buf)
+	o.OnStart()
+
+	stats := newRequestStats(time.Microsecond)
+	stats.logRequest("http", "foo", 10*time.Millisecond, 100)
+	stats.logRequest("http", "foo", 30*time.Millisecond, 300)
+	stats.logError("http", "bar", "timeout")
+	data := stats.collectReportData()
+	data["user_count"] = int32(3)
+	o.OnEvent(data)
+
+	output := buf.String()
+	if !strings.Contains(output, "Users: 3") {
+		t.Error("user count is missing", output)
+	}
+	for _, fields := range [][]string{
+		{"http", "foo", "2", "0(0.00%)", "0.67", "10.00", "20.00", "30.00"},
+		{"http", "bar", "0", "1(100.00%)"},
+		{"Total", "2", "1(33.33%)"},
+	} {
+		found := false
+		for _, line := range strings.Split(output, "\n") {
+			if strings.HasPrefix(strings.Join(strings.Fields(line), " "), strings.Join(fields, " ")) {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("missing row", fields, output)
+		}
+	}
+
+	buf.Reset()
+	o.OnStop()
+	if !strings.Contains(buf.String(), "Totals:") {
+		t.Error("totals are missing", buf.String())
+	}
+}
@@ -0,0 +1,115 @@
+package boomer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CSVOutput writes results in the same columns as locust's --csv.
+type CSVOutput struct {
+	*fileOutput
+}
+
+// NewCSVOutput returns a CSVOutput that writes PREFIX_stats.csv, PREFIX_stats_history.csv
+// and PREFIX_failures.csv, files are flushed every flushInterval.
+func NewCSVOutput(prefix string, flushInterval time.Duration) *CSVOutput {
+	return &CSVOutput{newFileOutput(prefix, flushInterval, csvFormat{})}
+}
+
+type csvFormat struct{}
+
+func (csvFormat) extension() string {
+	return "csv"
+}
+
+func percentileHeaders() []string {
+	headers := make([]string, 0, len(reportedPercentiles))
+	for _, percent := range reportedPercentiles {
+		headers = append(headers, fmt.Sprintf("%g%%", percent))
+	}
+	return headers
+}
+
+func percentileColumns(e *outputEntry) []string {
+	columns := make([]string, 0, len(reportedPercentiles))
+	for _, percent := range reportedPercentiles {
+		columns = append(columns, formatMilliseconds(e.percentile(percent)))
+	}
+	return columns
+}
+
+// csvName names the total like locust does.
+func csvName(stats *outputEntries, e *outputEntry) string {
+	if e == stats.total {
+		return "Aggregated"
+	}
+	return e.name
+}
+
+func (csvFormat) writeHistoryHeader(w io.Writer) error {
+	headers := []string{"Timestamp", "User Count", "Type", "Name", "Requests/s", "Failures/s"}
+	headers = append(headers, percentileHeaders()...)
+	headers = append(headers, "Total Request Count", "Total Failure Count", "Total Median Response Time",
+		"Total Average Response Time", "Total Min Response Time", "Total Max Response Time", "Total Average Content Size")
+	writer := csv.NewWriter(w)
+	writer.Write(headers)
+	writer.Flush()
+	return writer.Error()
+}
+
+func (csvFormat) writeHistory(w io.Writer, data map[string]interface{}, stats *outputEntries) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	userCount := strconv.FormatInt(toInt64(data["user_count"]), 10)
+	writer := csv.NewWriter(w)
+	for _, e := range append(stats.sorted(), stats.total) {
+		row := []string{timestamp, userCount, e.method, csvName(stats, e),
+			formatFloat(float64(e.lastRequests) / slaveReportInterval.Seconds()),
+			formatFloat(float64(e.lastFailures) / slaveReportInterval.Seconds()),
+		}
+		row = append(row, percentileColumns(e)...)
+		row = append(row, strconv.FormatInt(e.numRequests, 10), strconv.FormatInt(e.numFailures, 10),
+			formatMilliseconds(e.percentile(50)), formatMilliseconds(e.avgResponseTime()),
+			formatMilliseconds(e.minResponseTime), formatMilliseconds(e.maxResponseTime),
+			strconv.FormatInt(e.avgContentLength(), 10))
+		writer.Write(row)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (csvFormat) writeStats(w io.Writer, stats *outputEntries) error {
+	headers := []string{"Type", "Name", "Request Count", "Failure Count", "Median Response Time",
+		"Average Response Time", "Min Response Time", "Max Response Time", "Average Content Size",
+		"Requests/s", "Failures/s"}
+	headers = append(headers, percentileHeaders()...)
+	writer := csv.NewWriter(w)
+	writer.Write(headers)
+
+	elapsed := stats.elapsed()
+	for _, e := range append(stats.sorted(), stats.total) {
+		row := []string{e.method, csvName(stats, e),
+			strconv.FormatInt(e.numRequests, 10), strconv.FormatInt(e.numFailures, 10),
+			formatMilliseconds(e.percentile(50)), formatMilliseconds(e.avgResponseTime()),
+			formatMilliseconds(e.minResponseTime), formatMilliseconds(e.maxResponseTime),
+			strconv.FormatInt(e.avgContentLength(), 10),
+			formatFloat(float64(e.numRequests) / elapsed), formatFloat(float64(e.numFailures) / elapsed),
+		}
+		row = append(row, percentileColumns(e)...)
+		writer.Write(row)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (csvFormat) writeFailures(w io.Writer, stats *outputEntries) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Method", "Name", "Error", "Occurrences"})
+	for _, e := range stats.sortedErrors() {
+		writer.Write([]string{e.method, e.name, e.error, strconv.FormatInt(e.occurrences, 10)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
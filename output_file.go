@@ -0,0 +1,150 @@
+package boomer
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// fileFormat writes results in a file format, like CSV.
+type fileFormat interface {
+	extension() string
+	writeHistoryHeader(w io.Writer) error
+	// writeHistory writes a report, stats holds the report already.
+	writeHistory(w io.Writer, data map[string]interface{}, stats *outputEntries) error
+	writeStats(w io.Writer, stats *outputEntries) error
+	writeFailures(w io.Writer, stats *outputEntries) error
+}
+
+// fileOutput appends every report to PREFIX_stats_history.EXT, and writes the stats
+// and failures since users start hatching to PREFIX_stats.EXT and PREFIX_failures.EXT.
+// Files are flushed every flushInterval and when users are stopped.
+type fileOutput struct {
+	prefix        string
+	flushInterval time.Duration
+	format        fileFormat
+
+	mutex         sync.Mutex
+	stats         *outputEntries
+	history       *os.File
+	historyWriter *bufio.Writer
+	lastFlush     time.Time
+}
+
+func newFileOutput(prefix string, flushInterval time.Duration, format fileFormat) *fileOutput {
+	return &fileOutput{
+		prefix:        prefix,
+		flushInterval: flushInterval,
+		format:        format,
+		stats:         newOutputEntries(),
+	}
+}
+
+func (o *fileOutput) path(name string) string {
+	return o.prefix + "_" + name + "." + o.format.extension()
+}
+
+// OnStart implements Output.
+func (o *fileOutput) OnStart() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.closeHistory()
+	o.stats = newOutputEntries()
+	o.lastFlush = time.Now()
+
+	history, err := os.Create(o.path("stats_history"))
+	if err != nil {
+		log.Println("Failed to create the history of stats:", err)
+		return
+	}
+	o.history = history
+	o.historyWriter = bufio.NewWriter(history)
+	if err := o.format.writeHistoryHeader(o.historyWriter); err != nil {
+		log.Println("Failed to write the history of stats:", err)
+	}
+}
+
+// OnEvent implements Output.
+func (o *fileOutput) OnEvent(data map[string]interface{}) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.stats.extend(data)
+	if o.historyWriter != nil {
+		if err := o.format.writeHistory(o.historyWriter, data, o.stats); err != nil {
+			log.Println("Failed to write the history of stats:", err)
+		}
+	}
+
+	if time.Since(o.lastFlush) >= o.flushInterval {
+		o.flush()
+	}
+}
+
+// OnStop implements Output.
+func (o *fileOutput) OnStop() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.flush()
+	o.closeHistory()
+}
+
+// flush writes the history to disk and rewrites the stats and failures.
+func (o *fileOutput) flush() {
+	o.lastFlush = time.Now()
+	if o.historyWriter != nil {
+		if err := o.historyWriter.Flush(); err != nil {
+			log.Println("Failed to write the history of stats:", err)
+		}
+	}
+	if err := o.writeFile("stats", o.format.writeStats); err != nil {
+		log.Println("Failed to write stats:", err)
+	}
+	if err := o.writeFile("failures", o.format.writeFailures); err != nil {
+		log.Println("Failed to write failures:", err)
+	}
+}
+
+func (o *fileOutput) writeFile(name string, write func(w io.Writer, stats *outputEntries) error) error {
+	// write to a temporary file, so readers never see a half written file
+	path := o.path(name)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = write(w, o.stats)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (o *fileOutput) closeHistory() {
+	if o.history == nil {
+		return
+	}
+	o.historyWriter.Flush()
+	o.history.Close()
+	o.history = nil
+	o.historyWriter = nil
+}
+
+// formatMilliseconds keeps microseconds of a response time in milliseconds.
+func formatMilliseconds(ms float64) string {
+	return strconv.FormatFloat(math.Round(ms*1000)/1000, 'f', -1, 64)
+}
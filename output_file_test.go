@@ -0,0 +1,128 @@
+package boomer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestReport(o Output) {
+	o.OnStart()
+	stats := newRequestStats(time.Microsecond)
+	stats.logRequest("http", "foo", 10*time.Millisecond, 100)
+	stats.logRequest("http", "foo", 30*time.Millisecond, 300)
+	stats.logError("http", "bar", "timeout")
+	data := stats.collectReportData()
+	data["user_count"] = int32(3)
+	o.OnEvent(data)
+	o.OnStop()
+}
+
+func readCSV(t *testing.T, path string) [][]string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestCSVOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boomer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	prefix := filepath.Join(dir, "result")
+
+	writeTestReport(NewCSVOutput(prefix, time.Hour))
+
+	stats := readCSV(t, prefix+"_stats.csv")
+	if len(stats) != 4 {
+		t.Fatal("unexpected rows of stats", stats)
+	}
+	if stats[0][0] != "Type" || stats[0][11] != "50%" {
+		t.Error("unexpected header of stats", stats[0])
+	}
+	// the median is the upper bound of a bucket, so it's left out
+	if strings.Join(append(stats[2][:4:4], stats[2][5:9]...), ",") != "http,foo,2,0,20,10,30,200" {
+		t.Error("unexpected stats of foo", stats[2])
+	}
+	if stats[3][1] != "Aggregated" || stats[3][2] != "2" || stats[3][3] != "1" {
+		t.Error("unexpected total", stats[3])
+	}
+
+	history := readCSV(t, prefix+"_stats_history.csv")
+	if len(history) != 4 {
+		t.Fatal("unexpected rows of history", history)
+	}
+	if history[1][1] != "3" {
+		t.Error("unexpected user count", history[1])
+	}
+
+	failures := readCSV(t, prefix+"_failures.csv")
+	if len(failures) != 2 || strings.Join(failures[1], ",") != "http,bar,timeout,1" {
+		t.Error("unexpected failures", failures)
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boomer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	prefix := filepath.Join(dir, "result")
+
+	writeTestReport(NewJSONOutput(prefix, time.Hour))
+
+	readLines := func(path string) []map[string]interface{} {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lines []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+			var v map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &v); err != nil {
+				t.Fatal(err, line)
+			}
+			lines = append(lines, v)
+		}
+		return lines
+	}
+
+	stats := readLines(prefix + "_stats.jsonl")
+	if len(stats) != 3 {
+		t.Fatal("unexpected lines of stats", stats)
+	}
+	foo := stats[1]
+	if foo["name"] != "foo" || foo["num_requests"] != float64(2) || foo["avg_response_time"] != float64(20) {
+		t.Error("unexpected stats of foo", foo)
+	}
+	if _, ok := foo["percentiles"].(map[string]interface{})["p99"]; !ok {
+		t.Error("percentiles are missing", foo)
+	}
+
+	history := readLines(prefix + "_stats_history.jsonl")
+	if len(history) != 1 || history[0]["user_count"] != float64(3) {
+		t.Error("unexpected history", history)
+	}
+	if total := history[0]["stats_total"].(map[string]interface{}); total["histogram"] != nil {
+		t.Error("the histogram shouldn't be written", total)
+	}
+
+	failures := readLines(prefix + "_failures.jsonl")
+	if len(failures) != 1 || failures[0]["error"] != "timeout" || failures[0]["occurrences"] != float64(1) {
+		t.Error("unexpected failures", failures)
+	}
+}
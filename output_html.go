@@ -0,0 +1,262 @@
+package boomer
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// HTMLOutput writes a report in a single HTML file when users are stopped.
+// Scripts and styles are embedded, so the report can be opened offline.
+type HTMLOutput struct {
+	path string
+
+	mutex       sync.Mutex
+	entries     *outputEntries
+	intervals   []htmlInterval
+	abortReason string
+}
+
+// htmlInterval is a point of the charts, response times are in milliseconds.
+type htmlInterval struct {
+	Time      int64   `json:"time"`
+	UserCount int64   `json:"user_count"`
+	RPS       float64 `json:"rps"`
+	FPS       float64 `json:"fps"`
+	P50       float64 `json:"p50"`
+	P95       float64 `json:"p95"`
+	P99       float64 `json:"p99"`
+}
+
+// htmlRow is a row of the requests table, response times are in milliseconds.
+type htmlRow struct {
+	Method, Name       string
+	Requests, Failures int64
+	RPS, FPS           float64
+	Min, Avg, Max      float64
+	P50, P90, P95, P99 float64
+	Size               int64
+}
+
+type htmlError struct {
+	Method, Name, Error string
+	Occurrences         int64
+}
+
+// NewHTMLOutput returns a HTMLOutput that writes the report to path.
+func NewHTMLOutput(path string) *HTMLOutput {
+	return &HTMLOutput{
+		path:    path,
+		entries: newOutputEntries(),
+	}
+}
+
+// OnStart implements Output.
+func (o *HTMLOutput) OnStart() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.entries = newOutputEntries()
+	o.intervals = nil
+	o.abortReason = ""
+}
+
+// OnEvent implements Output.
+func (o *HTMLOutput) OnEvent(data map[string]interface{}) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.entries.extend(data)
+	if reason, ok := data["abort_reason"].(string); ok {
+		o.abortReason = reason
+	}
+
+	interval := htmlInterval{
+		Time:      time.Now().UnixNano() / int64(time.Millisecond),
+		UserCount: toInt64(data["user_count"]),
+		RPS:       float64(o.entries.total.lastRequests) / slaveReportInterval.Seconds(),
+		FPS:       float64(o.entries.total.lastFailures) / slaveReportInterval.Seconds(),
+	}
+	// percentiles of the interval come from the histogram of the last report
+	if total, ok := data["stats_total"].(map[string]interface{}); ok {
+		if h, ok := total["histogram"].(*histogram); ok {
+			interval.P50 = toMilliseconds(h.percentile(50))
+			interval.P95 = toMilliseconds(h.percentile(95))
+			interval.P99 = toMilliseconds(h.percentile(99))
+		}
+	}
+	o.intervals = append(o.intervals, interval)
+}
+
+// OnStop implements Output.
+func (o *HTMLOutput) OnStop() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if err := o.write(); err != nil {
+		log.Println("Failed to write the HTML report:", err)
+		return
+	}
+	log.Println("HTML report is written to", o.path)
+}
+
+func (o *HTMLOutput) write() error {
+	// an empty array rather than null, so the charts are still drawn
+	intervals, err := json.Marshal(append([]htmlInterval{}, o.intervals...))
+	if err != nil {
+		return err
+	}
+
+	elapsed := o.entries.elapsed()
+	var rows []htmlRow
+	for _, e := range append(o.entries.sorted(), o.entries.total) {
+		rows = append(rows, htmlRow{
+			Method: e.method, Name: e.name,
+			Requests: e.numRequests, Failures: e.numFailures,
+			RPS: float64(e.numRequests) / elapsed, FPS: float64(e.numFailures) / elapsed,
+			Min: e.minResponseTime, Avg: e.avgResponseTime(), Max: e.maxResponseTime,
+			P50: e.percentile(50), P90: e.percentile(90), P95: e.percentile(95), P99: e.percentile(99),
+			Size: e.avgContentLength(),
+		})
+	}
+	var errors []htmlError
+	for _, e := range o.entries.sortedErrors() {
+		errors = append(errors, htmlError{e.method, e.name, e.error, e.occurrences})
+	}
+
+	buf := new(bytes.Buffer)
+	err = htmlTemplate.Execute(buf, map[string]interface{}{
+		"Start":       o.entries.startTime.Format(time.RFC3339),
+		"End":         time.Now().Format(time.RFC3339),
+		"AbortReason": o.abortReason,
+		"Entries":     rows,
+		"Errors":      errors,
+		"Intervals":   template.JS(intervals),
+	})
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file, so readers never see a half written report
+	if err := ioutil.WriteFile(o.path+".tmp", buf.Bytes(), 0644); err != nil {
+		os.Remove(o.path + ".tmp")
+		return err
+	}
+	return os.Rename(o.path+".tmp", o.path)
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(htmlReport))
+
+const htmlReport = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Boomer Report</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; margin: 20px 40px; color: #333; }
+h1 { font-size: 24px; }
+h2 { font-size: 18px; margin-top: 32px; }
+table { border-collapse: collapse; font-size: 13px; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: right; }
+th { background: #f4f4f4; }
+td.text { text-align: left; }
+tr:last-child td { font-weight: bold; }
+table.errors tr:last-child td { font-weight: normal; }
+p.aborted { color: #d00000; font-weight: bold; }
+canvas { border: 1px solid #ddd; display: block; margin-bottom: 8px; }
+</style>
+</head>
+<body>
+<h1>Boomer Report</h1>
+<p>From {{.Start}} to {{.End}}</p>
+{{if .AbortReason}}<p class="aborted">Aborted, {{.AbortReason}}</p>{{end}}
+
+<h2>Requests</h2>
+<table>
+<tr><th>Type</th><th>Name</th><th># reqs</th><th># fails</th><th>req/s</th><th>failures/s</th><th>min(ms)</th><th>avg(ms)</th><th>max(ms)</th><th>p50(ms)</th><th>p90(ms)</th><th>p95(ms)</th><th>p99(ms)</th><th>avg size(bytes)</th></tr>
+{{range .Entries}}<tr><td class="text">{{.Method}}</td><td class="text">{{.Name}}</td><td>{{.Requests}}</td><td>{{.Failures}}</td><td>{{printf "%.2f" .RPS}}</td><td>{{printf "%.2f" .FPS}}</td><td>{{printf "%.2f" .Min}}</td><td>{{printf "%.2f" .Avg}}</td><td>{{printf "%.2f" .Max}}</td><td>{{printf "%.2f" .P50}}</td><td>{{printf "%.2f" .P90}}</td><td>{{printf "%.2f" .P95}}</td><td>{{printf "%.2f" .P99}}</td><td>{{.Size}}</td></tr>
+{{end}}</table>
+
+<h2>Errors</h2>
+{{if .Errors}}<table class="errors">
+<tr><th>Type</th><th>Name</th><th>Error</th><th>Occurrences</th></tr>
+{{range .Errors}}<tr><td class="text">{{.Method}}</td><td class="text">{{.Name}}</td><td class="text">{{.Error}}</td><td>{{.Occurrences}}</td></tr>
+{{end}}</table>{{else}}<p>No errors.</p>{{end}}
+
+<h2>Requests per Second</h2>
+<canvas id="rps" width="1000" height="280"></canvas>
+<h2>Response Times (ms)</h2>
+<canvas id="response-times" width="1000" height="280"></canvas>
+<h2>Number of Users</h2>
+<canvas id="users" width="1000" height="280"></canvas>
+
+<script>
+var intervals = {{.Intervals}};
+
+function drawChart(id, series) {
+  var canvas = document.getElementById(id), ctx = canvas.getContext("2d");
+  var left = 60, right = 20, top = 30, bottom = 30;
+  var width = canvas.width - left - right, height = canvas.height - top - bottom;
+  var maxValue = 0;
+  series.forEach(function (s) {
+    intervals.forEach(function (p) { maxValue = Math.max(maxValue, p[s.key]); });
+  });
+  if (maxValue === 0) { maxValue = 1; }
+  var start = intervals.length ? intervals[0].time : 0;
+  var end = intervals.length ? intervals[intervals.length - 1].time : 1;
+  if (end === start) { end = start + 1; }
+  var x = function (t) { return left + (t - start) / (end - start) * width; };
+  var y = function (v) { return top + height - v / maxValue * height; };
+
+  ctx.font = "11px sans-serif";
+  ctx.strokeStyle = "#ddd";
+  ctx.fillStyle = "#666";
+  ctx.textAlign = "right";
+  for (var i = 0; i <= 4; i++) {
+    var v = maxValue * i / 4;
+    ctx.beginPath(); ctx.moveTo(left, y(v)); ctx.lineTo(left + width, y(v)); ctx.stroke();
+    ctx.fillText(v.toFixed(v < 10 ? 2 : 0), left - 6, y(v) + 4);
+  }
+  ctx.textAlign = "center";
+  for (var i = 0; i <= 4; i++) {
+    var t = start + (end - start) * i / 4;
+    ctx.fillText(new Date(t).toLocaleTimeString(), x(t), top + height + 18);
+  }
+
+  var legend = left;
+  series.forEach(function (s) {
+    ctx.strokeStyle = s.color;
+    ctx.lineWidth = 2;
+    ctx.beginPath();
+    intervals.forEach(function (p, i) {
+      if (i === 0) { ctx.moveTo(x(p.time), y(p[s.key])); } else { ctx.lineTo(x(p.time), y(p[s.key])); }
+    });
+    ctx.stroke();
+    ctx.lineWidth = 1;
+    ctx.fillStyle = s.color;
+    ctx.fillRect(legend, 10, 10, 10);
+    ctx.fillStyle = "#333";
+    ctx.textAlign = "left";
+    ctx.fillText(s.name, legend + 14, 19);
+    legend += ctx.measureText(s.name).width + 34;
+  });
+}
+
+drawChart("rps", [
+  {key: "rps", name: "RPS", color: "#00a000"},
+  {key: "fps", name: "Failures/s", color: "#d00000"}
+]);
+drawChart("response-times", [
+  {key: "p50", name: "p50", color: "#0060c0"},
+  {key: "p95", name: "p95", color: "#e08000"},
+  {key: "p99", name: "p99", color: "#a000a0"}
+]);
+drawChart("users", [
+  {key: "user_count", name: "Users", color: "#0060c0"}
+]);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,55 @@
+package boomer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTMLIntervalPercentiles(t *testing.T) {
+	o := NewHTMLOutput("report.html")
+	o.OnStart()
+	stats := newRequestStats(time.Microsecond)
+	for i := 0; i < 100; i++ {
+		stats.logRequest("http", "foo", 250*time.Microsecond, 10)
+	}
+	o.OnEvent(stats.collectReportData())
+
+	// locust rounds them to 0ms
+	interval := o.intervals[0]
+	if interval.P50 != 0.25 || interval.P99 != 0.25 {
+		t.Error("p50 and p99 should be 0.25ms, got", interval.P50, interval.P99)
+	}
+}
+
+func TestHTMLOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boomer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "report.html")
+
+	o := NewHTMLOutput(path)
+	writeTestReport(o)
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := string(content)
+	for _, s := range []string{"<td class=\"text\">foo</td>", "<td class=\"text\">timeout</td>", "\"user_count\":3"} {
+		if !strings.Contains(report, s) {
+			t.Error("missing", s, "in the report")
+		}
+	}
+	// the report must be self-contained
+	for _, s := range []string{"src=", "href="} {
+		if strings.Contains(report, s) {
+			t.Error("unexpected", s, "in the report")
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package boomer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// JSONOutput writes results in JSON Lines, one JSON object per line.
+type JSONOutput struct {
+	*fileOutput
+}
+
+// NewJSONOutput returns a JSONOutput that writes PREFIX_stats.jsonl, PREFIX_stats_history.jsonl
+// and PREFIX_failures.jsonl, files are flushed every flushInterval.
+//
+// Every line of the history is a report as it's sent to master, with a timestamp.
+// Every line of the stats is an entry since users start hatching, response times are in milliseconds.
+func NewJSONOutput(prefix string, flushInterval time.Duration) *JSONOutput {
+	return &JSONOutput{newFileOutput(prefix, flushInterval, jsonFormat{})}
+}
+
+type jsonFormat struct{}
+
+func (jsonFormat) extension() string {
+	return "jsonl"
+}
+
+func (jsonFormat) writeHistoryHeader(w io.Writer) error {
+	return nil
+}
+
+func (jsonFormat) writeHistory(w io.Writer, data map[string]interface{}, stats *outputEntries) error {
+	entries, _ := data["stats"].([]interface{})
+	lineEntries := make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		lineEntries = append(lineEntries, withoutHistogram(entry))
+	}
+	line := map[string]interface{}{
+		"timestamp":   time.Now().Unix(),
+		"user_count":  data["user_count"],
+		"stats":       lineEntries,
+		"stats_total": withoutHistogram(data["stats_total"]),
+		"errors":      data["errors"],
+	}
+	if reason, ok := data["abort_reason"]; ok {
+		line["abort_reason"] = reason
+	}
+	if dropped, ok := data["dropped_iterations"]; ok {
+		line["dropped_iterations"] = dropped
+	}
+	return json.NewEncoder(w).Encode(line)
+}
+
+// withoutHistogram copies an entry of the report without "histogram", which has nothing to be encoded.
+func withoutHistogram(entry interface{}) map[string]interface{} {
+	e, _ := entry.(map[string]interface{})
+	copied := make(map[string]interface{}, len(e))
+	for k, v := range e {
+		if k != "histogram" {
+			copied[k] = v
+		}
+	}
+	return copied
+}
+
+func (jsonFormat) writeStats(w io.Writer, stats *outputEntries) error {
+	encoder := json.NewEncoder(w)
+	elapsed := stats.elapsed()
+	for _, e := range append(stats.sorted(), stats.total) {
+		percentiles := make(map[string]float64, len(reportedPercentiles))
+		for _, percent := range reportedPercentiles {
+			percentiles[fmt.Sprintf("p%g", percent)] = e.percentile(percent)
+		}
+		line := map[string]interface{}{
+			"method":               e.method,
+			"name":                 e.name,
+			"num_requests":         e.numRequests,
+			"num_failures":         e.numFailures,
+			"avg_response_time":    e.avgResponseTime(),
+			"min_response_time":    e.minResponseTime,
+			"max_response_time":    e.maxResponseTime,
+			"avg_content_length":   e.avgContentLength(),
+			"total_content_length": e.totalContentLength,
+			"requests_per_second":  float64(e.numRequests) / elapsed,
+			"failures_per_second":  float64(e.numFailures) / elapsed,
+			"percentiles":          percentiles,
+		}
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (jsonFormat) writeFailures(w io.Writer, stats *outputEntries) error {
+	encoder := json.NewEncoder(w)
+	for _, e := range stats.sortedErrors() {
+		line := map[string]interface{}{
+			"method":      e.method,
+			"name":        e.name,
+			"error":       e.error,
+			"occurrences": e.occurrences,
+		}
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
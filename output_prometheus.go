@@ -0,0 +1,198 @@
+package boomer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// prometheusBuckets are the upper bounds of response time buckets, in milliseconds.
+var prometheusBuckets = []float64{1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// prometheusOutput accumulates the reports and exposes them in the text format of prometheus.
+// Reports are deltas since last report, so counters keep growing until boomer quits.
+type prometheusOutput struct {
+	nodeID   string
+	getState func() string
+
+	mutex   sync.Mutex
+	entries *outputEntries
+	// buckets are counted by name and method
+	buckets   map[string][]int64
+	userCount int64
+
+	listener net.Listener
+	server   *http.Server
+}
+
+func newPrometheusOutput(nodeID string, getState func() string) *prometheusOutput {
+	return &prometheusOutput{
+		nodeID:   nodeID,
+		getState: getState,
+		entries:  newOutputEntries(),
+		buckets:  make(map[string][]int64),
+	}
+}
+
+// listen serves /metrics on addr, it doesn't block.
+func (o *prometheusOutput) listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", o)
+	o.listener = listener
+	o.server = &http.Server{Handler: mux}
+	go func() {
+		if err := o.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Println("Prometheus endpoint stopped:", err)
+		}
+	}()
+	log.Printf("Prometheus metrics are served on http://%s/metrics\n", listener.Addr())
+	return nil
+}
+
+func (o *prometheusOutput) close() {
+	if o.server != nil {
+		o.server.Close()
+	}
+}
+
+// OnStart implements Output.
+func (o *prometheusOutput) OnStart() {}
+
+// OnEvent implements Output.
+func (o *prometheusOutput) OnEvent(data map[string]interface{}) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.entries.extend(data)
+	if entries, ok := data["stats"].([]interface{}); ok {
+		for _, entry := range entries {
+			o.count(entry.(map[string]interface{}))
+		}
+	}
+	o.userCount = toInt64(data["user_count"])
+}
+
+// count puts the response times of an entry into buckets, from the histogram rather than
+// the rounded response_times, so they're as precise as HistogramPrecision.
+func (o *prometheusOutput) count(data map[string]interface{}) {
+	key := toString(data["name"]) + toString(data["method"])
+	buckets, ok := o.buckets[key]
+	if !ok {
+		buckets = make([]int64, len(prometheusBuckets))
+		o.buckets[key] = buckets
+	}
+	h, ok := data["histogram"].(*histogram)
+	if !ok {
+		return
+	}
+	for index, count := range h.counts {
+		if count == 0 {
+			continue
+		}
+		responseTime := toMilliseconds(time.Duration(h.highestValueAt(index)) * h.unit)
+		for i, bound := range prometheusBuckets {
+			if responseTime <= bound {
+				buckets[i] += count
+			}
+		}
+	}
+}
+
+// OnStop implements Output.
+func (o *prometheusOutput) OnStop() {}
+
+func (o *prometheusOutput) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(o.metrics())
+}
+
+// metrics writes all the metrics in the text format of prometheus.
+func (o *prometheusOutput) metrics() []byte {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	buf := new(bytes.Buffer)
+	node := labels("node_id", o.nodeID)
+
+	entries := o.entries.sorted()
+
+	writeHeader(buf, "boomer_requests_total", "counter", "Number of successful requests.")
+	for _, e := range entries {
+		fmt.Fprintf(buf, "boomer_requests_total{%s} %d\n", entryLabels(node, e), e.numRequests)
+	}
+	writeHeader(buf, "boomer_failures_total", "counter", "Number of failed requests.")
+	for _, e := range entries {
+		fmt.Fprintf(buf, "boomer_failures_total{%s} %d\n", entryLabels(node, e), e.numFailures)
+	}
+	writeHeader(buf, "boomer_content_length_bytes_total", "counter", "Total content length of successful requests.")
+	for _, e := range entries {
+		fmt.Fprintf(buf, "boomer_content_length_bytes_total{%s} %d\n", entryLabels(node, e), e.totalContentLength)
+	}
+	writeHeader(buf, "boomer_response_time_seconds", "histogram", "Response times of successful requests.")
+	for _, e := range entries {
+		buckets := o.buckets[e.name+e.method]
+		for i, bound := range prometheusBuckets {
+			fmt.Fprintf(buf, "boomer_response_time_seconds_bucket{%s,%s} %d\n",
+				entryLabels(node, e), labels("le", formatFloat(bound/1000)), buckets[i])
+		}
+		fmt.Fprintf(buf, "boomer_response_time_seconds_bucket{%s,le=\"+Inf\"} %d\n", entryLabels(node, e), e.numRequests)
+		fmt.Fprintf(buf, "boomer_response_time_seconds_sum{%s} %s\n", entryLabels(node, e), formatFloat(e.totalResponseTime/1000))
+		fmt.Fprintf(buf, "boomer_response_time_seconds_count{%s} %d\n", entryLabels(node, e), e.numRequests)
+	}
+
+	writeHeader(buf, "boomer_errors_total", "counter", "Number of occurrences of each error.")
+	for _, e := range o.entries.sortedErrors() {
+		fmt.Fprintf(buf, "boomer_errors_total{%s,%s,%s,%s} %d\n", node,
+			labels("method", e.method), labels("name", e.name), labels("error", e.error), e.occurrences)
+	}
+
+	writeHeader(buf, "boomer_response_time_percentile_seconds", "gauge", "Percentiles of all the response times since hatching.")
+	for _, percent := range reportedPercentiles {
+		fmt.Fprintf(buf, "boomer_response_time_percentile_seconds{%s,%s} %s\n",
+			node, labels("quantile", formatFloat(percent/100)), formatFloat(o.entries.total.percentile(percent)/1000))
+	}
+
+	writeHeader(buf, "boomer_dropped_iterations_total", "counter", "Number of iterations dropped by the arrival-rate executor.")
+	fmt.Fprintf(buf, "boomer_dropped_iterations_total{%s} %d\n", node, o.entries.droppedIterations)
+
+	writeHeader(buf, "boomer_users", "gauge", "Number of running users.")
+	fmt.Fprintf(buf, "boomer_users{%s} %d\n", node, o.userCount)
+
+	writeHeader(buf, "boomer_state", "gauge", "State of the runner, the current one is 1.")
+	state := o.getState()
+	for _, s := range []string{stateInit, stateHatching, stateRunning, stateStopped} {
+		value := 0
+		if s == state {
+			value = 1
+		}
+		fmt.Fprintf(buf, "boomer_state{%s,%s} %d\n", node, labels("state", s), value)
+	}
+	return buf.Bytes()
+}
+
+func entryLabels(node string, e *outputEntry) string {
+	return node + "," + labels("method", e.method) + "," + labels("name", e.name)
+}
+
+func writeHeader(buf *bytes.Buffer, name, metricType, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labels(name, value string) string {
+	return fmt.Sprintf(`%s="%s"`, name, labelValueReplacer.Replace(value))
+}
+
+func formatFloat(f float64) string {
+	return fmt.Sprintf("%g", f)
+}
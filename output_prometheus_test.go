@@ -0,0 +1,58 @@
+package boomer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusOutput(t *testing.T) {
+	o := newPrometheusOutput("node", func() string { return stateRunning })
+	if err := o.listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer o.close()
+
+	stats := newRequestStats(time.Microsecond)
+	for i := 0; i < 2; i++ {
+		stats.logRequest("http", "foo", 3*time.Millisecond, 10)
+		stats.logError("http", "foo", `500 "error"`)
+		// locust rounds them to 0 and 250ms
+		stats.logRequest("http", "bar", 300*time.Microsecond, 10)
+		stats.logRequest("http", "bar", 254*time.Millisecond, 10)
+		data := stats.collectReportData()
+		data["user_count"] = int32(5)
+		o.OnEvent(data)
+	}
+
+	resp, err := http.Get("http://" + o.listener.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	metrics := string(body)
+
+	labels := `node_id="node",method="http",name="foo"`
+	expected := []string{
+		`boomer_requests_total{` + labels + `} 2`,
+		`boomer_failures_total{` + labels + `} 2`,
+		`boomer_content_length_bytes_total{` + labels + `} 20`,
+		`boomer_response_time_seconds_bucket{` + labels + `,le="0.0025"} 0`,
+		`boomer_response_time_seconds_bucket{` + labels + `,le="0.005"} 2`,
+		`boomer_response_time_seconds_sum{` + labels + `} 0.006`,
+		`boomer_response_time_seconds_bucket{node_id="node",method="http",name="bar",le="0.001"} 2`,
+		`boomer_response_time_seconds_bucket{node_id="node",method="http",name="bar",le="0.25"} 2`,
+		`boomer_response_time_seconds_bucket{node_id="node",method="http",name="bar",le="0.5"} 4`,
+		`boomer_errors_total{node_id="node",method="http",name="foo",error="500 \"error\""} 2`,
+		`boomer_users{node_id="node"} 5`,
+		`boomer_state{node_id="node",state="running"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Error("missing", line)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package boomer
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Versions of locust master, see Config.Protocol.
+const (
+	// ProtocolLocust0 talks to locust before 1.0, with hatch messages
+	// over zeromq push/pull sockets or tcp socket.
+	ProtocolLocust0 = "0.x"
+	// ProtocolLocust1 talks to locust 1.x, with spawn messages over a zeromq dealer socket.
+	ProtocolLocust1 = "1.x"
+	// ProtocolLocust2 talks to locust 2.x, spawn messages carry the count of each user class.
+	ProtocolLocust2 = "2.x"
+)
+
+// versionOfLocust2 is sent with client_ready, locust 2.x skips the version check for -1.
+const versionOfLocust2 = -1
+
+// protocol maps the messages of different locust versions onto the same runner operations.
+// Messages from master are understood in all the dialects, messages to master are
+// written in the configured one.
+type protocol struct {
+	version string
+
+	mutex              sync.Mutex
+	userClassesCount   map[string]interface{}
+	lastSpawnTimestamp float64
+}
+
+func newProtocol(version string) (*protocol, error) {
+	switch version {
+	case ProtocolLocust0, ProtocolLocust1, ProtocolLocust2:
+		return &protocol{version: version}, nil
+	}
+	return nil, fmt.Errorf("unknown protocol: %s", version)
+}
+
+// dealer returns true if master uses a zeromq router socket.
+func (p *protocol) dealer() bool {
+	return p.version != ProtocolLocust0
+}
+
+func (p *protocol) clientReady(nodeID string) *message {
+	msg := newMessage("client_ready", nil, nodeID)
+	if p.version == ProtocolLocust2 {
+		// locust 2.x refuses workers whose client_ready carries no version
+		msg.rawData = versionOfLocust2
+	}
+	return msg
+}
+
+// parseSpawn reads the number of clients and the hatch rate from a hatch or spawn message,
+// ok is false if the message should be ignored.
+func (p *protocol) parseSpawn(msg *message) (numClients int, hatchRate int, ok bool) {
+	var rate float64
+	switch {
+	case msg.Type == "hatch":
+		rate = toFloat64(msg.Data["hatch_rate"])
+		numClients = int(toInt64(msg.Data["num_clients"]))
+	case msg.Data["user_classes_count"] != nil:
+		// locust 2.x ramps up by itself, every spawn message is the new total
+		timestamp := toFloat64(msg.Data["timestamp"])
+		userClassesCount, _ := msg.Data["user_classes_count"].(map[interface{}]interface{})
+
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		if timestamp > 0 && timestamp <= p.lastSpawnTimestamp {
+			// messages may be delivered out of order after a reconnection
+			return 0, 0, false
+		}
+		p.lastSpawnTimestamp = timestamp
+		p.userClassesCount = make(map[string]interface{}, len(userClassesCount))
+		for k, v := range userClassesCount {
+			p.userClassesCount[toString(k)] = v
+			numClients += int(toInt64(v))
+		}
+		rate = float64(numClients)
+	default:
+		rate = toFloat64(msg.Data["spawn_rate"])
+		numClients = int(toInt64(msg.Data["num_users"]))
+	}
+
+	hatchRate = int(rate)
+	if hatchRate == 0 && rate > 0 {
+		// the rate is split across workers by master, it can be less than 1
+		hatchRate = 1
+	}
+	return numClients, hatchRate, numClients > 0 && hatchRate > 0
+}
+
+func (p *protocol) spawning(nodeID string) *message {
+	if p.version == ProtocolLocust0 {
+		return newMessage("hatching", nil, nodeID)
+	}
+	return newMessage("spawning", nil, nodeID)
+}
+
+func (p *protocol) spawningComplete(nodeID string, count int32) *message {
+	data := make(map[string]interface{})
+	switch p.version {
+	case ProtocolLocust0:
+		data["count"] = count
+		return newMessage("hatch_complete", data, nodeID)
+	case ProtocolLocust1:
+		data["count"] = count
+	case ProtocolLocust2:
+		data["user_count"] = count
+		data["user_classes_count"] = p.getUserClassesCount()
+	}
+	return newMessage("spawning_complete", data, nodeID)
+}
+
+func (p *protocol) getUserClassesCount() map[string]interface{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.userClassesCount == nil {
+		return map[string]interface{}{}
+	}
+	return p.userClassesCount
+}
+
+func (p *protocol) heartbeat(nodeID string, state string, cpuUsage float64) *message {
+	data := make(map[string]interface{})
+	data["state"] = state
+	data["current_cpu_usage"] = cpuUsage
+	if p.version == ProtocolLocust2 {
+		var memStats runtime.MemStats
+		runtime.ReadMemStats(&memStats)
+		data["current_memory_usage"] = memStats.Sys
+	}
+	return newMessage("heartbeat", data, nodeID)
+}
+
+// stats removes the fields for local outputs from a report of requestStats, and adds the fields
+// that newer locust requires. The report is shared with outputs, so it's copied before being changed.
+func (p *protocol) stats(nodeID string, data map[string]interface{}) *message {
+	report := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		report[k] = v
+	}
+
+	entries, _ := data["stats"].([]interface{})
+	extendedEntries := make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		extendedEntries = append(extendedEntries, p.extendEntry(entry.(map[string]interface{})))
+	}
+	report["stats"] = extendedEntries
+	if total, ok := data["stats_total"].(map[string]interface{}); ok {
+		report["stats_total"] = p.extendEntry(total)
+	}
+	if p.version == ProtocolLocust0 {
+		return newMessage("stats", report, nodeID)
+	}
+
+	// locust 1.0 fixed the typo
+	errors, _ := data["errors"].(map[string]map[string]interface{})
+	renamedErrors := make(map[string]map[string]interface{}, len(errors))
+	for key, e := range errors {
+		renamed := make(map[string]interface{}, len(e))
+		for k, v := range e {
+			renamed[k] = v
+		}
+		renamed["occurrences"] = renamed["occurences"]
+		delete(renamed, "occurences")
+		renamedErrors[key] = renamed
+	}
+	report["errors"] = renamedErrors
+
+	if p.version == ProtocolLocust2 {
+		report["user_classes_count"] = p.getUserClassesCount()
+	}
+	return newMessage("stats", report, nodeID)
+}
+
+func (p *protocol) extendEntry(entry map[string]interface{}) map[string]interface{} {
+	extended := make(map[string]interface{}, len(entry)+2)
+	for k, v := range entry {
+		extended[k] = v
+	}
+	delete(extended, "histogram")
+	if p.version == ProtocolLocust0 {
+		return extended
+	}
+	extended["num_none_requests"] = int64(0)
+	if _, ok := extended["num_fail_per_sec"]; !ok {
+		extended["num_fail_per_sec"] = map[int64]int64{}
+	}
+	return extended
+}
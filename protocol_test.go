@@ -0,0 +1,92 @@
+package boomer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+func TestParseSpawn(t *testing.T) {
+	p, _ := newProtocol(ProtocolLocust2)
+
+	hatch := newMessage("hatch", map[string]interface{}{"hatch_rate": float64(10), "num_clients": uint64(100)}, "")
+	if numClients, hatchRate, ok := p.parseSpawn(hatch); !ok || numClients != 100 || hatchRate != 10 {
+		t.Error("wrong hatch message", numClients, hatchRate, ok)
+	}
+
+	spawn := newMessage("spawn", map[string]interface{}{"spawn_rate": 0.5, "num_users": int64(3)}, "")
+	if numClients, hatchRate, ok := p.parseSpawn(spawn); !ok || numClients != 3 || hatchRate != 1 {
+		t.Error("wrong locust 1.x spawn message", numClients, hatchRate, ok)
+	}
+
+	userClassesCount := map[string]int64{"a": 2, "b": 3}
+	spawn = newMessage("spawn", map[string]interface{}{"user_classes_count": userClassesCount, "timestamp": 2.0}, "")
+	// decode it like a message from master
+	spawn = newMessageFromBytes(spawn.serialize())
+	if numClients, hatchRate, ok := p.parseSpawn(spawn); !ok || numClients != 5 || hatchRate != 5 {
+		t.Error("wrong locust 2.x spawn message", numClients, hatchRate, ok)
+	}
+	if p.getUserClassesCount()["b"] != int64(3) {
+		t.Error("user classes count is not kept", p.getUserClassesCount())
+	}
+
+	stale := newMessage("spawn", map[string]interface{}{"user_classes_count": userClassesCount, "timestamp": 1.0}, "")
+	stale = newMessageFromBytes(stale.serialize())
+	if _, _, ok := p.parseSpawn(stale); ok {
+		t.Error("stale spawn message is not ignored")
+	}
+
+	invalid := newMessage("hatch", map[string]interface{}{"hatch_rate": float64(0), "num_clients": int64(1)}, "")
+	if _, _, ok := p.parseSpawn(invalid); ok {
+		t.Error("invalid hatch message is not ignored")
+	}
+}
+
+func TestClientReady(t *testing.T) {
+	p, _ := newProtocol(ProtocolLocust1)
+	if msg := p.clientReady("node"); msg.rawData != nil {
+		t.Error("locust 1.x doesn't expect a version", msg.rawData)
+	}
+
+	p, _ = newProtocol(ProtocolLocust2)
+	var decoded []interface{}
+	if err := codec.NewDecoderBytes(p.clientReady("node").serialize(), &mh).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if toString(decoded[0]) != "client_ready" || toInt64(decoded[1]) != versionOfLocust2 || toString(decoded[2]) != "node" {
+		t.Error("wrong client_ready message", decoded)
+	}
+}
+
+func TestStatsForNewerLocust(t *testing.T) {
+	stats := newRequestStats(time.Microsecond)
+	stats.logRequest("http", "success", 2*time.Millisecond, 30)
+	stats.logError("http", "failure", "500 error")
+	data := stats.collectReportData()
+
+	p, _ := newProtocol(ProtocolLocust1)
+	msg := p.stats("node", data)
+
+	entry := msg.Data["stats_total"].(map[string]interface{})
+	if _, ok := entry["num_none_requests"]; !ok {
+		t.Error("num_none_requests is missing")
+	}
+	if _, ok := entry["histogram"]; ok {
+		t.Error("histogram is for local outputs")
+	}
+	for _, e := range msg.Data["errors"].(map[string]map[string]interface{}) {
+		if e["occurrences"] != int64(1) {
+			t.Error("occurrences is missing", e)
+		}
+		if _, ok := e["occurences"]; ok {
+			t.Error("occurences should be renamed")
+		}
+	}
+}
+
+func TestUnknownProtocol(t *testing.T) {
+	if _, err := newProtocol("3.x"); err == nil {
+		t.Error("expect an error")
+	}
+}
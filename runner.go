@@ -1,10 +1,11 @@
 package boomer
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"os"
 	"runtime/debug"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -26,17 +27,163 @@ const (
 type Task struct {
 	Weight int
 	Fn     func()
-	Name   string
+	// FnCtx is run instead of Fn if it's set, ctx is cancelled when users are stopped
+	// or the user is one of the surplus when hatching again, so long running tasks can return early.
+	FnCtx func(ctx context.Context)
+	// NewUser creates a User for every goroutine if it's set,
+	// and FnUser is run instead of Fn and FnCtx with the user of the goroutine.
+	NewUser func() User
+	FnUser  func(ctx context.Context, user User)
+	// WaitTime is how long a user waits after every iteration, users don't wait if it's nil.
+	WaitTime WaitTime
+	Name     string
+
+	// taskSet is the TaskSet of AsTask, Run checks that it has tasks
+	taskSet *TaskSet
+}
+
+// statsContextKey keeps the stats of the runner in the context of tasks.
+type statsContextKey struct{}
+
+func (task *Task) run(ctx context.Context, user User) {
+	if task.FnUser != nil {
+		task.FnUser(ctx, user)
+		return
+	}
+	if task.FnCtx != nil {
+		task.FnCtx(ctx)
+		return
+	}
+	task.Fn()
 }
 
 type runner struct {
-	tasks       []*Task
-	numClients  int32
-	hatchRate   int
-	stopChannel chan bool
-	state       string
-	client      client
-	nodeID      string
+	tasks []*Task
+	// numClients is the number of running users
+	numClients int32
+	client     client
+	protocol   *protocol
+	outputs    []Output
+	// outputMutex makes sure that outputs are called one at a time
+	outputMutex sync.Mutex
+
+	// mutex protects state, hatchChannel, ctx, cancel and users, they are changed by
+	// messages from master as well as Boomer's methods.
+	mutex sync.Mutex
+	// hatchChannel is closed when users are stopped or hatching again, running users keep running
+	// when hatching again, and only the difference is hatched or stopped.
+	hatchChannel chan bool
+	// ctx is the context of tasks, cancel cancels it when users are stopped
+	ctx    context.Context
+	cancel context.CancelFunc
+	state  string
+	// users of the users executor, in the order they're hatched
+	users []*runningUser
+
+	nodeID string
+	stats  *requestStats
+
+	fromMaster      chan *message
+	toMaster        chan *message
+	quitChannel     chan bool
+	shutdownChannel chan bool
+
+	maxRPS               int64
+	maxRPSThreshold      int64
+	maxRPSEnabled        bool
+	maxRPSControlChannel chan bool
+
+	disconnectPolicy string
+
+	heartbeatInterval      time.Duration
+	masterHeartbeatTimeout time.Duration
+	// unix nano of the last heartbeat from master, 0 if master doesn't send heartbeats
+	lastMasterHeartbeat int64
+
+	// abortGuard is nil if there are no limits, it's protected by mutex as well as abortReason
+	abortGuard  *abortGuard
+	abortReason string
+	// abortedChannel receives the reason when users are aborted
+	abortedChannel chan string
+
+	// runningUsers is replaced when users start hatching, it's protected by mutex
+	runningUsers *sync.WaitGroup
+	// stop waits for running tasks to return for stopTimeout, 0 means no wait
+	stopTimeout time.Duration
+
+	// runTime and the iteration limits stop users, 0 means no limit
+	runTime           time.Duration
+	runTimer          *time.Timer
+	iterations        int64
+	iterationsPerUser int64
+	// iterationsStarted counts the iterations of all the users since they start hatching
+	iterationsStarted int64
+	// finishedChannel receives the reason when users reach a limit
+	finishedChannel chan string
+
+	executor            string
+	arrivalDistribution string
+	maxWorkers          int
+	arrivalIdleTimeout  time.Duration
+	// arrivalPool is replaced when users start hatching, it's protected by mutex
+	arrivalPool *arrivalPool
+	// arrivalRate is the current rate of the arrival rate executor, in bits of float64
+	arrivalRate uint64
+	// droppedIterations counts the iterations dropped by the arrival rate executor since last report
+	droppedIterations int64
+}
+
+// runningUser is a user goroutine of the users executor, it returns when quit is closed.
+type runningUser struct {
+	quit   chan bool
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newRunner(tasks []*Task, stats *requestStats, config Config) *runner {
+	protocol, err := newProtocol(config.Protocol)
+	if err != nil {
+		log.Fatal(err)
+	}
+	r := &runner{
+		tasks:           tasks,
+		protocol:        protocol,
+		nodeID:          getNodeID(),
+		stats:           stats,
+		fromMaster:      make(chan *message, 100),
+		toMaster:        make(chan *message, 100),
+		quitChannel:     make(chan bool),
+		shutdownChannel: make(chan bool),
+
+		maxRPS:               config.MaxRPS,
+		maxRPSControlChannel: make(chan bool),
+
+		disconnectPolicy: config.DisconnectPolicy,
+
+		heartbeatInterval:      config.HeartbeatInterval,
+		masterHeartbeatTimeout: config.MasterHeartbeatTimeout,
+
+		abortGuard:     newAbortGuard(config.AbortFailureRatio, config.AbortP95, config.AbortWindow),
+		abortedChannel: make(chan string, 1),
+
+		runningUsers: &sync.WaitGroup{},
+		stopTimeout:  config.StopTimeout,
+
+		runTime:           config.RunTime,
+		iterations:        config.Iterations,
+		iterationsPerUser: config.IterationsPerUser,
+		finishedChannel:   make(chan string, 1),
+
+		executor:            config.Executor,
+		arrivalDistribution: config.ArrivalDistribution,
+		maxWorkers:          config.MaxWorkers,
+		arrivalIdleTimeout:  arrivalIdleTimeout,
+	}
+	if r.maxRPS > 0 {
+		log.Println("Max RPS that boomer may generate is limited to", r.maxRPS)
+		r.maxRPSEnabled = true
+	}
+	return r
 }
 
 func (r *runner) safeRun(fn func()) {
@@ -45,15 +192,21 @@ func (r *runner) safeRun(fn func()) {
 		err := recover()
 		if err != nil {
 			debug.PrintStack()
-			Events.Publish("request_failure", "unknown", "panic", 0.0, fmt.Sprintf("%v", err))
+			r.stats.logError("unknown", "panic", fmt.Sprintf("%v", err))
 		}
 	}()
 	fn()
 }
 
-func (r *runner) spawnGoRoutines(spawnCount int, quit chan bool) {
+// spawnGoRoutines hatches spawnCount more users, the ones that are running aren't touched.
+func (r *runner) spawnGoRoutines(ctx context.Context, spawnCount int, hatchRate int, hatch chan bool) {
 
-	log.Println("Hatching and swarming", spawnCount, "clients at the rate", r.hatchRate, "clients/s...")
+	log.Println("Hatching and swarming", spawnCount, "clients at the rate", hatchRate, "clients/s...")
+
+	// users of this hatching
+	var users sync.WaitGroup
+	// exhausted is set when a user of this hatching runs out of iterations
+	var exhausted int32
 
 	weightSum := 0
 	for _, task := range r.tasks {
@@ -71,86 +224,332 @@ func (r *runner) spawnGoRoutines(spawnCount int, quit chan bool) {
 
 		for i := 1; i <= amount; i++ {
 			select {
-			case <-quit:
+			case <-hatch:
 				// quit hatching goroutine
 				return
 			default:
-				if i%r.hatchRate == 0 {
+				if i%hatchRate == 0 {
 					time.Sleep(1 * time.Second)
 				}
-				atomic.AddInt32(&r.numClients, 1)
-				go func(fn func()) {
+				running, runningUsers := r.addRunningUser(ctx, hatch)
+				if running == nil {
+					return
+				}
+				users.Add(1)
+				go func(task *Task) {
+					defer func() {
+						r.removeRunningUser(running)
+						atomic.AddInt32(&r.numClients, -1)
+						runningUsers.Done()
+						users.Done()
+					}()
+					ctx, quit := running.ctx, running.quit
+					user := task.newUser()
+					if user != nil {
+						r.safeRun(func() { user.OnStart(ctx) })
+						// stop waits for OnStop as well
+						defer r.safeRun(user.OnStop)
+					}
+					fn := func() { task.run(ctx, user) }
+					var iterations int64
 					for {
 						select {
 						case <-quit:
 							return
 						default:
-							if maxRPSEnabled {
-								token := atomic.AddInt64(&maxRPSThreshold, -1)
-								if token < 0 {
-									// max RPS is reached, wait until next second
-									<-maxRPSControlChannel
-								} else {
-									r.safeRun(fn)
+						}
+						if r.maxRPSEnabled {
+							token := atomic.AddInt64(&r.maxRPSThreshold, -1)
+							if token < 0 {
+								// max RPS is reached, wait until next second
+								select {
+								case <-r.maxRPSControlChannel:
+								case <-quit:
+									return
 								}
-							} else {
-								r.safeRun(fn)
+								continue
 							}
 						}
+						if r.iterations > 0 && atomic.AddInt64(&r.iterationsStarted, 1) > r.iterations {
+							atomic.StoreInt32(&exhausted, 1)
+							return
+						}
+						start := time.Now()
+						r.safeRun(fn)
+						iterations++
+						if r.iterationsPerUser > 0 && iterations >= r.iterationsPerUser {
+							atomic.StoreInt32(&exhausted, 1)
+							return
+						}
+						if task.WaitTime != nil && !r.wait(task.WaitTime(time.Since(start)), quit) {
+							return
+						}
 					}
-				}(task.Fn)
+				}(task)
 			}
 
 		}
 
 	}
 
-	r.hatchComplete()
+	select {
+	case <-hatch:
+		// stopped or hatching again before all the clients are hatched
+		return
+	default:
+		r.hatchComplete(int32(r.userCount()))
+	}
+
+	if r.iterations > 0 || r.iterationsPerUser > 0 {
+		// users return when they run out of iterations, the ones of
+		// other hatchings may still be running
+		go func() {
+			users.Wait()
+			if ctx.Err() == nil && atomic.LoadInt32(&exhausted) == 1 && r.userCount() == 0 {
+				r.finish("All the iterations are done")
+			}
+		}()
+	}
 
 }
 
-func (r *runner) startHatching(spawnCount int, hatchRate int) {
+// wait returns false if users are stopped while waiting.
+func (r *runner) wait(d time.Duration, quit chan bool) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-quit:
+		return false
+	}
+}
 
-	if r.state != stateRunning && r.state != stateHatching {
-		clearStatsChannel <- true
-		r.stopChannel = make(chan bool)
+// addUser counts a new user, it returns the WaitGroup of running users,
+// or nil if users are stopped or hatching again.
+func (r *runner) addUser(quit chan bool) *sync.WaitGroup {
+	// users are added with mutex, so stop never waits while a user is added
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	select {
+	case <-quit:
+		return nil
+	default:
 	}
+	atomic.AddInt32(&r.numClients, 1)
+	r.runningUsers.Add(1)
+	return r.runningUsers
+}
 
-	if r.state == stateRunning || r.state == stateHatching {
-		// stop previous goroutines without blocking
-		// those goroutines will exit when r.safeRun returns
-		close(r.stopChannel)
+// addRunningUser counts a new user of the users executor like addUser, it returns nil
+// if users are stopped or hatching again.
+func (r *runner) addRunningUser(ctx context.Context, hatch chan bool) (*runningUser, *sync.WaitGroup) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	select {
+	case <-hatch:
+		return nil, nil
+	default:
 	}
+	atomic.AddInt32(&r.numClients, 1)
+	r.runningUsers.Add(1)
+	user := &runningUser{quit: make(chan bool)}
+	user.ctx, user.cancel = context.WithCancel(ctx)
+	r.users = append(r.users, user)
+	return user, r.runningUsers
+}
+
+// removeRunningUser forgets a user that has returned, unless it's stopped already.
+func (r *runner) removeRunningUser(user *runningUser) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	user.cancel()
+	for i, u := range r.users {
+		if u == user {
+			r.users = append(r.users[:i], r.users[i+1:]...)
+			return
+		}
+	}
+}
+
+// stopRunningUsers stops the last count users that are hatched, mutex must be held.
+func (r *runner) stopRunningUsers(count int) {
+	if count > len(r.users) {
+		count = len(r.users)
+	}
+	for _, user := range r.users[len(r.users)-count:] {
+		close(user.quit)
+		user.cancel()
+	}
+	r.users = r.users[:len(r.users)-count]
+}
 
-	r.stopChannel = make(chan bool)
+// userCount returns the number of users of the users executor.
+func (r *runner) userCount() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.users)
+}
+
+func (r *runner) startHatching(spawnCount int, hatchRate int) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.state != stateRunning && r.state != stateHatching {
+		r.stats.clearStatsChannel <- true
+		r.abortReason = ""
+		if r.abortGuard != nil {
+			r.abortGuard.reset()
+		}
+		atomic.StoreInt64(&r.iterationsStarted, 0)
+		r.runningUsers = &sync.WaitGroup{}
+		r.ctx, r.cancel = context.WithCancel(context.WithValue(context.Background(), statsContextKey{}, r.stats))
+		r.arrivalPool = newArrivalPool(r.maxWorkers, r.arrivalIdleTimeout)
+		r.storeArrivalRate(0)
+		if r.runTime > 0 {
+			r.runTimer = time.AfterFunc(r.runTime, func() {
+				r.finish(fmt.Sprintf("Time limit %v reached", r.runTime))
+			})
+		}
+		r.outputOnStart()
+	} else {
+		// locust 2.x sends spawn every second while ramping, running users keep running,
+		// the previous hatching goroutine stops, and only the difference is hatched or stopped.
+		close(r.hatchChannel)
+	}
+
+	r.hatchChannel = make(chan bool)
 	r.state = stateHatching
 
-	r.hatchRate = hatchRate
-	r.numClients = 0
-	go r.spawnGoRoutines(spawnCount, r.stopChannel)
+	if r.executor == ExecutorArrivalRate {
+		go r.spawnArrivals(r.ctx, spawnCount, hatchRate, r.hatchChannel, r.arrivalPool)
+		return
+	}
+	extra := spawnCount - len(r.users)
+	if extra < 0 {
+		r.stopRunningUsers(-extra)
+		extra = 0
+	}
+	go r.spawnGoRoutines(r.ctx, extra, hatchRate, r.hatchChannel)
 }
 
-func (r *runner) hatchComplete() {
+func (r *runner) hatchComplete(spawned int32) {
 
-	data := make(map[string]interface{})
-	data["count"] = r.numClients
-	toMaster <- newMessage("hatch_complete", data, r.nodeID)
+	r.toMaster <- r.protocol.spawningComplete(r.nodeID, spawned)
 
-	r.state = stateRunning
+	r.mutex.Lock()
+	if r.state == stateHatching {
+		r.state = stateRunning
+	}
+	r.mutex.Unlock()
 }
 
 func (r *runner) onQuiting() {
-	toMaster <- newMessage("quit", nil, r.nodeID)
+	r.toMaster <- newMessage("quit", nil, r.nodeID)
 }
 
+// stop stops running users, waits for their tasks to return and reports the last stats,
+// so client_stopped can be sent after it. Tasks must not call it, or it waits until stopTimeout.
 func (r *runner) stop() {
 
+	r.mutex.Lock()
+	stopped := false
+	var runningUsers *sync.WaitGroup
 	if r.state == stateRunning || r.state == stateHatching {
-		close(r.stopChannel)
+		close(r.hatchChannel)
+		r.stopRunningUsers(len(r.users))
+		r.cancel()
 		r.state = stateStopped
-		log.Println("Recv stop message from master, all the goroutines are stopped")
+		stopped = true
+		runningUsers = r.runningUsers
+		if r.runTimer != nil {
+			r.runTimer.Stop()
+			r.runTimer = nil
+		}
 	}
+	r.mutex.Unlock()
 
+	if stopped {
+		r.waitForUsers(runningUsers)
+		// report what's left before outputs are stopped
+		if data := r.stats.flush(); data != nil {
+			r.reportStats(data)
+		}
+		r.outputOnStop()
+	}
+
+}
+
+// abort stops running users like master does, and tells master why.
+func (r *runner) abort(reason string) {
+	r.mutex.Lock()
+	if r.abortReason != "" || (r.state != stateRunning && r.state != stateHatching) {
+		r.mutex.Unlock()
+		return
+	}
+	r.abortReason = reason
+	r.mutex.Unlock()
+
+	log.Println("Aborting,", reason)
+	// locust shows exceptions of workers in the web UI
+	r.toMaster <- newMessage("exception", map[string]interface{}{
+		"msg":       "Aborted, " + reason,
+		"traceback": "",
+	}, r.nodeID)
+	r.stop()
+	r.toMaster <- newMessage("client_stopped", nil, r.nodeID)
+	r.toMaster <- r.protocol.clientReady(r.nodeID)
+
+	select {
+	case r.abortedChannel <- reason:
+	default:
+	}
+}
+
+// waitForUsers waits for running tasks to return, so their results are in the last report.
+func (r *runner) waitForUsers(runningUsers *sync.WaitGroup) {
+	if r.stopTimeout <= 0 {
+		log.Println("All the goroutines are told to stop")
+		return
+	}
+	done := make(chan bool)
+	go func() {
+		runningUsers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Println("All the goroutines are stopped")
+	case <-time.After(r.stopTimeout):
+		log.Println(atomic.LoadInt32(&r.numClients), "goroutines are still running after", r.stopTimeout)
+	}
+}
+
+// finish stops running users when they reach a limit, like master does.
+func (r *runner) finish(reason string) {
+	if state := r.getState(); state != stateRunning && state != stateHatching {
+		return
+	}
+
+	log.Println(reason + ", stopping users")
+	r.stop()
+	r.toMaster <- newMessage("client_stopped", nil, r.nodeID)
+	r.toMaster <- r.protocol.clientReady(r.nodeID)
+
+	select {
+	case r.finishedChannel <- reason:
+	default:
+	}
+}
+
+func (r *runner) getState() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.state
 }
 
 func (r *runner) getReady() {
@@ -160,59 +559,157 @@ func (r *runner) getReady() {
 	// read message from master
 	go func() {
 		for {
-			msg := <-fromMaster
+			var msg *message
+			select {
+			case msg = <-r.fromMaster:
+			case <-r.shutdownChannel:
+				return
+			}
 			switch msg.Type {
-			case "hatch":
-				toMaster <- newMessage("hatching", nil, r.nodeID)
-				rate, _ := msg.Data["hatch_rate"]
-				clients, _ := msg.Data["num_clients"]
-				hatchRate := int(rate.(float64))
-				workers := 0
-				if _, ok := clients.(uint64); ok {
-					workers = int(clients.(uint64))
-				} else {
-					workers = int(clients.(int64))
-				}
-				if workers == 0 || hatchRate == 0 {
-					log.Printf("Invalid hatch message from master, num_clients is %d, hatch_rate is %d\n",
-						workers, hatchRate)
-				} else {
-					r.startHatching(workers, hatchRate)
+			case "hatch", "spawn":
+				workers, hatchRate, ok := r.protocol.parseSpawn(msg)
+				if !ok {
+					log.Printf("Invalid %s message from master, %v\n", msg.Type, msg.Data)
+					continue
 				}
+				r.toMaster <- r.protocol.spawning(r.nodeID)
+				r.startHatching(workers, hatchRate)
 			case "stop":
+				log.Println("Recv stop message from master")
 				r.stop()
-				toMaster <- newMessage("client_stopped", nil, r.nodeID)
-				toMaster <- newMessage("client_ready", nil, r.nodeID)
+				r.toMaster <- newMessage("client_stopped", nil, r.nodeID)
+				r.toMaster <- r.protocol.clientReady(r.nodeID)
+			case disconnectedMessageType:
+				log.Println("Disconnected from master, running users are kept:", r.disconnectPolicy == DisconnectPolicyKeep)
+				if r.disconnectPolicy == DisconnectPolicyStop {
+					r.stop()
+				}
+			case "heartbeat":
+				atomic.StoreInt64(&r.lastMasterHeartbeat, time.Now().UnixNano())
+			case reconnectedMessageType, "reconnect":
+				// master may have restarted and forgotten about us,
+				// locust 2.x asks unknown workers to reconnect.
+				r.toMaster <- r.protocol.clientReady(r.nodeID)
 			case "quit":
 				log.Println("Got quit message from master, shutting down...")
-				os.Exit(0)
+				r.stop()
+				close(r.quitChannel)
+				return
 			}
 		}
 	}()
 
 	// tell master, I'm ready
-	toMaster <- newMessage("client_ready", nil, r.nodeID)
+	r.toMaster <- r.protocol.clientReady(r.nodeID)
 
 	// report to master
 	go func() {
 		for {
 			select {
-			case data := <-messageToRunner:
-				data["user_count"] = r.numClients
-				toMaster <- newMessage("stats", data, r.nodeID)
+			case data := <-r.stats.messageToRunner:
+				r.reportStats(data)
+			case <-r.shutdownChannel:
+				return
 			}
 		}
 	}()
 
-	if maxRPSEnabled {
+	if r.heartbeatInterval > 0 {
+		go r.heartbeat()
+	}
+
+	if r.maxRPSEnabled {
 		go func() {
 			for {
-				atomic.StoreInt64(&maxRPSThreshold, maxRPS)
-				time.Sleep(1 * time.Second)
+				atomic.StoreInt64(&r.maxRPSThreshold, r.maxRPS)
+				select {
+				case <-time.After(1 * time.Second):
+				case <-r.shutdownChannel:
+					return
+				}
 				// use channel to broadcast
-				close(maxRPSControlChannel)
-				maxRPSControlChannel = make(chan bool)
+				close(r.maxRPSControlChannel)
+				r.maxRPSControlChannel = make(chan bool)
 			}
 		}()
 	}
 }
+
+// reportStats sends a report of requestStats to outputs and master.
+func (r *runner) reportStats(data map[string]interface{}) {
+	data["user_count"] = atomic.LoadInt32(&r.numClients)
+	if r.executor == ExecutorArrivalRate {
+		data["dropped_iterations"] = atomic.SwapInt64(&r.droppedIterations, 0)
+	}
+
+	r.mutex.Lock()
+	if r.abortReason != "" {
+		if r.state == stateStopped {
+			// it's the last report after users are aborted
+			data["abort_reason"] = r.abortReason
+			r.abortReason = ""
+		}
+	} else if r.abortGuard != nil && (r.state == stateRunning || r.state == stateHatching) {
+		if reason := r.abortGuard.check(data); reason != "" {
+			// abort waits for the last report, which comes from this goroutine
+			go r.abort(reason)
+		}
+	}
+	r.mutex.Unlock()
+
+	r.outputOnEvent(data)
+	r.toMaster <- r.protocol.stats(r.nodeID, data)
+}
+
+func (r *runner) outputOnStart() {
+	r.outputMutex.Lock()
+	defer r.outputMutex.Unlock()
+	for _, output := range r.outputs {
+		output.OnStart()
+	}
+}
+
+func (r *runner) outputOnEvent(data map[string]interface{}) {
+	r.outputMutex.Lock()
+	defer r.outputMutex.Unlock()
+	for _, output := range r.outputs {
+		output.OnEvent(data)
+	}
+}
+
+func (r *runner) outputOnStop() {
+	r.outputMutex.Lock()
+	defer r.outputMutex.Unlock()
+	for _, output := range r.outputs {
+		output.OnStop()
+	}
+}
+
+// heartbeat tells master that we are alive, and stops running users
+// if master, which has sent heartbeats before, goes away.
+func (r *runner) heartbeat() {
+	ticker := time.NewTicker(r.heartbeatInterval)
+	defer ticker.Stop()
+	cpu := newCPUMonitor()
+	for {
+		select {
+		case <-ticker.C:
+			r.toMaster <- r.protocol.heartbeat(r.nodeID, r.getState(), cpu.usage())
+
+			last := atomic.LoadInt64(&r.lastMasterHeartbeat)
+			if r.masterHeartbeatTimeout > 0 && last > 0 && time.Since(time.Unix(0, last)) > r.masterHeartbeatTimeout {
+				log.Println("No heartbeat from master in", r.masterHeartbeatTimeout)
+				// wait for master to show up again
+				atomic.StoreInt64(&r.lastMasterHeartbeat, 0)
+				r.stop()
+			}
+		case <-r.shutdownChannel:
+			return
+		}
+	}
+}
+
+// close stops the goroutines started by getReady.
+func (r *runner) close() {
+	close(r.shutdownChannel)
+}
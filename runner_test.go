@@ -0,0 +1,320 @@
+package boomer
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	stats := newRequestStats(time.Microsecond)
+	config := DefaultConfig()
+	config.HeartbeatInterval = 10 * time.Millisecond
+	r := newRunner(nil, stats, config)
+	r.getReady()
+	defer r.close()
+
+	for {
+		msg := <-r.toMaster
+		if msg.Type != "heartbeat" {
+			continue
+		}
+		if msg.Data["state"] != stateInit {
+			t.Error("heartbeat should carry the state, got", msg.Data["state"])
+		}
+		if _, ok := msg.Data["current_cpu_usage"].(float64); !ok {
+			t.Error("heartbeat should carry the cpu usage")
+		}
+		break
+	}
+}
+
+func TestStopWhenMasterIsMissing(t *testing.T) {
+	config := DefaultConfig()
+	config.Standalone = true
+	config.HeartbeatInterval = 10 * time.Millisecond
+	config.MasterHeartbeatTimeout = 50 * time.Millisecond
+	b := New(config)
+	if err := b.Run(&Task{Name: "foo", Fn: func() { time.Sleep(time.Millisecond) }}); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Quit()
+
+	time.Sleep(100 * time.Millisecond)
+	if state := b.runner.getState(); state == stateStopped {
+		t.Fatal("users shouldn't be stopped if master never sends heartbeats, state is", state)
+	}
+
+	b.runner.fromMaster <- newMessage("heartbeat", nil, "")
+	waitFor(t, time.Second, func() bool { return b.runner.getState() == stateStopped })
+}
+
+type recordingOutput struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (o *recordingOutput) record(event string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.events = append(o.events, event)
+}
+
+func (o *recordingOutput) getEvents() []string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return append([]string(nil), o.events...)
+}
+
+func (o *recordingOutput) OnStart() { o.record("start") }
+
+func (o *recordingOutput) OnEvent(data map[string]interface{}) { o.record("event") }
+
+func (o *recordingOutput) OnStop() { o.record("stop") }
+
+func TestOutputs(t *testing.T) {
+	stats := newRequestStats(time.Microsecond)
+	stats.start()
+	defer stats.close()
+	config := DefaultConfig()
+	config.HeartbeatInterval = 0
+	r := newRunner([]*Task{{Name: "foo", Weight: 1, Fn: func() { time.Sleep(time.Millisecond) }}}, stats, config)
+	output := &recordingOutput{}
+	r.outputs = []Output{output}
+	r.getReady()
+	defer r.close()
+
+	r.startHatching(1, 1)
+	stats.messageToRunner <- map[string]interface{}{}
+	waitFor(t, time.Second, func() bool { return len(output.getEvents()) == 2 })
+	r.stop()
+
+	// stats are flushed before outputs are stopped
+	events := output.getEvents()
+	if len(events) != 4 || events[0] != "start" || events[1] != "event" || events[2] != "event" || events[3] != "stop" {
+		t.Error("wrong events", events)
+	}
+}
+
+// newLimitedRunner returns a ready runner, close it and its stats after the test.
+func newLimitedRunner(config Config, counter *int64) *runner {
+	stats := newRequestStats(time.Microsecond)
+	stats.start()
+	config.HeartbeatInterval = 0
+	task := &Task{Name: "foo", Weight: 1, Fn: func() {
+		atomic.AddInt64(counter, 1)
+		time.Sleep(time.Millisecond)
+	}}
+	r := newRunner([]*Task{task}, stats, config)
+	r.getReady()
+	return r
+}
+
+func waitForFinish(t *testing.T, r *runner) string {
+	select {
+	case reason := <-r.finishedChannel:
+		if state := r.getState(); state != stateStopped {
+			t.Error("users should be stopped, state is", state)
+		}
+		return reason
+	case <-time.After(5 * time.Second):
+		t.Fatal("users aren't finished")
+	}
+	return ""
+}
+
+func TestIterations(t *testing.T) {
+	var counter int64
+	config := DefaultConfig()
+	config.Iterations = 25
+	r := newLimitedRunner(config, &counter)
+	defer r.stats.close()
+	defer r.close()
+	r.startHatching(4, 4)
+	waitForFinish(t, r)
+	if n := atomic.LoadInt64(&counter); n != 25 {
+		t.Error("tasks should run 25 times, got", n)
+	}
+
+	stopped := false
+	for len(r.toMaster) > 0 {
+		if msg := <-r.toMaster; msg.Type == "client_stopped" {
+			stopped = true
+		}
+	}
+	if !stopped {
+		t.Error("master should be told that users are stopped")
+	}
+}
+
+func TestIterationsPerUser(t *testing.T) {
+	var counter int64
+	config := DefaultConfig()
+	config.IterationsPerUser = 3
+	r := newLimitedRunner(config, &counter)
+	defer r.stats.close()
+	defer r.close()
+	r.startHatching(4, 4)
+	waitForFinish(t, r)
+	if n := atomic.LoadInt64(&counter); n != 12 {
+		t.Error("tasks should run 12 times, got", n)
+	}
+}
+
+func TestRunTime(t *testing.T) {
+	var counter int64
+	config := DefaultConfig()
+	config.RunTime = 50 * time.Millisecond
+	r := newLimitedRunner(config, &counter)
+	defer r.stats.close()
+	defer r.close()
+	start := time.Now()
+	r.startHatching(1, 1)
+	if reason := waitForFinish(t, r); !strings.HasPrefix(reason, "Time limit") {
+		t.Error("unexpected reason", reason)
+	}
+	if elapsed := time.Since(start); elapsed < config.RunTime {
+		t.Error("users are stopped too early", elapsed)
+	}
+}
+
+type totalOutput struct {
+	mutex     sync.Mutex
+	requests  int64
+	userCount int32
+}
+
+func (o *totalOutput) OnStart() {}
+
+func (o *totalOutput) OnEvent(data map[string]interface{}) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if total, ok := data["stats_total"].(map[string]interface{}); ok {
+		o.requests += toInt64(total["num_requests"])
+	}
+	o.userCount = data["user_count"].(int32)
+}
+
+func (o *totalOutput) OnStop() {}
+
+func TestStopWaitsForRunningTasks(t *testing.T) {
+	stats := newRequestStats(time.Microsecond)
+	stats.start()
+	defer stats.close()
+	config := DefaultConfig()
+	config.HeartbeatInterval = 0
+	var started, finished int64
+	task := &Task{Name: "foo", Weight: 1, Fn: func() {
+		atomic.AddInt64(&started, 1)
+		time.Sleep(50 * time.Millisecond)
+		stats.logRequest("http", "foo", 50*time.Millisecond, 10)
+		atomic.AddInt64(&finished, 1)
+	}}
+	r := newRunner([]*Task{task}, stats, config)
+	output := &totalOutput{}
+	r.outputs = []Output{output}
+	r.getReady()
+	defer r.close()
+
+	r.startHatching(3, 10)
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&r.numClients) == 3 })
+	// tasks are running
+	time.Sleep(10 * time.Millisecond)
+	r.stop()
+
+	if atomic.LoadInt64(&started) != atomic.LoadInt64(&finished) {
+		t.Error("stop should wait for running tasks")
+	}
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+	if output.requests != atomic.LoadInt64(&finished) {
+		t.Errorf("all the %d requests should be reported, got %d", finished, output.requests)
+	}
+	if output.userCount != 0 {
+		t.Error("no user should be running in the last report, got", output.userCount)
+	}
+}
+
+func TestContextIsCancelled(t *testing.T) {
+	stats := newRequestStats(time.Microsecond)
+	stats.start()
+	defer stats.close()
+	config := DefaultConfig()
+	config.HeartbeatInterval = 0
+	var started, cancelled int64
+	task := &Task{Name: "foo", Weight: 1, FnCtx: func(ctx context.Context) {
+		atomic.AddInt64(&started, 1)
+		<-ctx.Done()
+		atomic.AddInt64(&cancelled, 1)
+	}}
+	r := newRunner([]*Task{task}, stats, config)
+	r.getReady()
+	defer r.close()
+
+	r.startHatching(2, 10)
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&r.numClients) == 2 })
+	// hatching again cancels the surplus users only
+	r.startHatching(1, 10)
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt64(&cancelled) == 1 })
+	if n := atomic.LoadInt64(&started); n != 2 {
+		t.Error("no user should be started, got", n)
+	}
+
+	start := time.Now()
+	r.stop()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("stop should cancel running tasks, it takes", elapsed)
+	}
+	if n := atomic.LoadInt64(&cancelled); n != 2 {
+		t.Error("all the tasks should be cancelled, got", n)
+	}
+}
+
+func TestSpawnAgainKeepsRunningUsers(t *testing.T) {
+	stats := newRequestStats(time.Microsecond)
+	stats.start()
+	defer stats.close()
+	config := DefaultConfig()
+	config.HeartbeatInterval = 0
+	config.Protocol = ProtocolLocust2
+	var started, cancelled int64
+	task := &Task{Name: "foo", Weight: 1, FnCtx: func(ctx context.Context) {
+		atomic.AddInt64(&started, 1)
+		<-ctx.Done()
+		atomic.AddInt64(&cancelled, 1)
+	}}
+	r := newRunner([]*Task{task}, stats, config)
+	r.getReady()
+	defer r.close()
+	defer r.stop()
+
+	spawn := func(users int64, timestamp float64) {
+		msg := newMessage("spawn", map[string]interface{}{
+			"user_classes_count": map[string]int64{"foo": users},
+			"timestamp":          timestamp,
+		}, r.nodeID)
+		r.fromMaster <- newMessageFromBytes(msg.serialize())
+	}
+
+	// locust 2.x sends spawn every second while ramping
+	spawn(2, 1)
+	// the second user is hatched in the next second
+	waitFor(t, 3*time.Second, func() bool { return atomic.LoadInt32(&r.numClients) == 2 })
+	spawn(3, 2)
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&r.numClients) == 3 })
+	if n := atomic.LoadInt64(&started); n != 3 {
+		t.Error("only the extra user should be started, got", n)
+	}
+	if n := atomic.LoadInt64(&cancelled); n != 0 {
+		t.Error("the first users should keep running, got", n, "cancelled")
+	}
+
+	spawn(1, 3)
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&r.numClients) == 1 })
+	if n := atomic.LoadInt64(&cancelled); n != 2 {
+		t.Error("only the surplus users should be stopped, got", n)
+	}
+}
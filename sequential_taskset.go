@@ -0,0 +1,72 @@
+package boomer
+
+import (
+	"context"
+	"time"
+)
+
+// SequentialTaskSet is like locust's SequentialTaskSet, every iteration a user runs all the tasks
+// in order, like a journey of login, browse, add to cart and checkout.
+//
+// Like locust, the weight of a task is how many times it's repeated, and the journey ends early
+// only when a task calls InterruptTaskSet. A step that records a failure doesn't stop the journey,
+// call InterruptTaskSet after RecordFailure if the next steps depend on it, e.g. checkout after
+// a failed login. Pass AsTask to Run, it's spawned by Weight like other tasks.
+type SequentialTaskSet struct {
+	Name   string
+	Weight int
+	Tasks  []*Task
+	// WaitTime is how long a user waits after every iteration, WaitTime of tasks in the set are ignored.
+	WaitTime WaitTime
+	// NewUser creates a User for every goroutine if it's set, it's given to FnUser of all the tasks.
+	NewUser func() User
+	// RecordSteps records how long every step takes, with Name as the type and the name of the task as the name.
+	// Interrupted steps are recorded as failures. Steps aren't added to the total, or the requests made in them
+	// would be counted twice, so thresholds and abort limits without a name ignore them.
+	RecordSteps bool
+}
+
+// AsTask returns a Task that runs the whole journey every iteration.
+func (ts *SequentialTaskSet) AsTask() *Task {
+	return &Task{
+		Name:     ts.Name,
+		Weight:   ts.Weight,
+		WaitTime: ts.WaitTime,
+		NewUser:  ts.NewUser,
+		FnUser:   ts.run,
+	}
+}
+
+func (ts *SequentialTaskSet) run(ctx context.Context, user User) {
+	stats, _ := ctx.Value(statsContextKey{}).(*requestStats)
+	interrupt := &taskSetInterrupt{}
+	ctx = context.WithValue(ctx, taskSetContextKey{}, interrupt)
+	for _, task := range ts.Tasks {
+		repeat := task.Weight
+		if repeat < 1 {
+			repeat = 1
+		}
+		for i := 0; i < repeat; i++ {
+			select {
+			case <-ctx.Done():
+				// users are stopped in the middle of the journey
+				return
+			default:
+			}
+
+			start := time.Now()
+			task.run(ctx, user)
+			elapsed := time.Since(start)
+
+			if interrupt.interrupted {
+				if ts.RecordSteps && stats != nil {
+					stats.logStepError(ts.Name, task.Name, "interrupted")
+				}
+				return
+			}
+			if ts.RecordSteps && stats != nil {
+				stats.logStep(ts.Name, task.Name, elapsed)
+			}
+		}
+	}
+}
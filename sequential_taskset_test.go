@@ -0,0 +1,59 @@
+package boomer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSequentialTaskSet(t *testing.T) {
+	var steps []string
+	step := func(name string, weight int, interrupt bool) *Task {
+		return &Task{Name: name, Weight: weight, FnCtx: func(ctx context.Context) {
+			steps = append(steps, name)
+			if interrupt {
+				InterruptTaskSet(ctx)
+			}
+		}}
+	}
+	ts := &SequentialTaskSet{
+		Name:        "checkout",
+		Tasks:       []*Task{step("login", 0, false), step("browse", 2, false), step("pay", 1, true), step("logout", 1, false)},
+		RecordSteps: true,
+	}
+
+	stats := newRequestStats(time.Microsecond)
+	ctx := context.WithValue(context.Background(), statsContextKey{}, stats)
+	ts.AsTask().run(ctx, nil)
+
+	if len(steps) != 4 || steps[0] != "login" || steps[1] != "browse" || steps[2] != "browse" || steps[3] != "pay" {
+		t.Error("steps should run in order until the journey is interrupted, got", steps)
+	}
+
+	stats.mergeShards()
+	if entry := stats.get("browse", "checkout"); entry.numRequests != 2 {
+		t.Error("every step should be recorded, got", entry.numRequests)
+	}
+	if entry := stats.get("pay", "checkout"); entry.numRequests != 0 || entry.numFailures != 1 {
+		t.Error("the interrupted step should be recorded as a failure, got", entry.numRequests, entry.numFailures)
+	}
+	if _, ok := stats.entries["logout"+"checkout"]; ok {
+		t.Error("steps after the interrupted one shouldn't run")
+	}
+	if stats.total.numRequests != 0 || stats.total.numFailures != 0 {
+		t.Error("steps shouldn't be added to the total, got", stats.total.numRequests, stats.total.numFailures)
+	}
+}
+
+func TestSequentialTaskSetIsStopped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var steps int
+	ts := &SequentialTaskSet{Tasks: []*Task{
+		{FnCtx: func(ctx context.Context) { steps++; cancel() }},
+		{FnCtx: func(ctx context.Context) { steps++ }},
+	}}
+	ts.AsTask().run(ctx, nil)
+	if steps != 1 {
+		t.Error("the journey should end when users are stopped, got", steps)
+	}
+}
@@ -1,67 +1,136 @@
 package boomer
 
 import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// statsShardsPerCPU decides how many shards requests are spread over.
+const statsShardsPerCPU = 4
+
 type requestStats struct {
+	// entries, errors and total are the aggregation of shards, they are
+	// only accessed by the goroutine started by start.
 	entries   map[string]*statsEntry
 	errors    map[string]*statsError
 	total     *statsEntry
 	startTime int64
+	// precision is the unit of latency histograms
+	precision time.Duration
+
+	// requests are logged into shards by the goroutines of users,
+	// shards are merged before reporting.
+	shards    []*statsShard
+	nextShard uint32
+
+	clearStatsChannel chan bool
+	flushChannel      chan chan map[string]interface{}
+	messageToRunner   chan map[string]interface{}
+	shutdownChannel   chan bool
 }
 
-func newRequestStats() *requestStats {
+func newRequestStats(precision time.Duration) *requestStats {
 	entries := make(map[string]*statsEntry)
 	errors := make(map[string]*statsError)
 
 	requestStats := &requestStats{
-		entries: entries,
-		errors:  errors,
+		entries:   entries,
+		errors:    errors,
+		precision: precision,
+		shards:    make([]*statsShard, runtime.GOMAXPROCS(0)*statsShardsPerCPU),
+
+		clearStatsChannel: make(chan bool),
+		flushChannel:      make(chan chan map[string]interface{}),
+		messageToRunner:   make(chan map[string]interface{}, 10),
+		shutdownChannel:   make(chan bool),
 	}
-
-	requestStats.total = &statsEntry{
-		name:   "Total",
-		method: "",
+	for i := range requestStats.shards {
+		requestStats.shards[i] = newStatsShard(precision)
 	}
-	requestStats.total.reset()
+
+	requestStats.total = newStatsEntry("Total", "", precision)
+	requestStats.total.cumulativeHistogram = newHistogram(precision)
 
 	return requestStats
 }
 
-func (s *requestStats) logRequest(method, name string, responseTime int64, contentLength int64) {
-	s.total.log(responseTime, contentLength)
-	s.get(name, method).log(responseTime, contentLength)
+// shard picks shards in turn, so concurrent users seldom wait for each other.
+func (s *requestStats) shard() *statsShard {
+	i := atomic.AddUint32(&s.nextShard, 1)
+	return s.shards[i%uint32(len(s.shards))]
+}
+
+// logRequest and logError are safe to be called by many goroutines.
+
+func (s *requestStats) logRequest(method, name string, responseTime time.Duration, contentLength int64) {
+	shard := s.shard()
+	shard.mutex.Lock()
+	shard.get(name, method).log(responseTime, contentLength)
+	shard.mutex.Unlock()
 }
 
 func (s *requestStats) logError(method, name, err string) {
-	s.total.logError(err)
-	s.get(name, method).logError(err)
+	shard := s.shard()
+	shard.mutex.Lock()
+	shard.get(name, method).logError(err)
+	shard.logError(method, name, err)
+	shard.mutex.Unlock()
+}
 
-	// store error in errors map
-	key := MD5(method, name, err)
-	entry, ok := s.errors[key]
-	if !ok {
-		entry = &statsError{
-			name:   name,
-			method: method,
-			error:  err,
+// logStep and logStepError record a step of a SequentialTaskSet, which isn't added to the total,
+// since the requests made in the step are recorded by themselves.
+
+func (s *requestStats) logStep(method, name string, responseTime time.Duration) {
+	shard := s.shard()
+	shard.mutex.Lock()
+	entry := shard.get(name, method)
+	entry.excludedFromTotal = true
+	entry.log(responseTime, 0)
+	shard.mutex.Unlock()
+}
+
+func (s *requestStats) logStepError(method, name, err string) {
+	shard := s.shard()
+	shard.mutex.Lock()
+	entry := shard.get(name, method)
+	entry.excludedFromTotal = true
+	entry.logError(err)
+	shard.logError(method, name, err)
+	shard.mutex.Unlock()
+}
+
+// mergeShards moves what shards have logged into entries, errors and total.
+func (s *requestStats) mergeShards() {
+	for _, shard := range s.shards {
+		entries, errors := shard.swap()
+		for _, entry := range entries {
+			s.get(entry.name, entry.method).merge(entry)
+			if !entry.excludedFromTotal {
+				s.total.merge(entry)
+			}
+		}
+		for _, err := range errors {
+			key := MD5(err.method, err.name, err.error)
+			if _, ok := s.errors[key]; !ok {
+				s.errors[key] = &statsError{
+					name:   err.name,
+					method: err.method,
+					error:  err.error,
+				}
+			}
+			s.errors[key].occurences += err.occurences
 		}
-		s.errors[key] = entry
 	}
-	entry.occured()
 }
 
 func (s *requestStats) get(name string, method string) (entry *statsEntry) {
 	entry, ok := s.entries[name+method]
 	if !ok {
-		newEntry := &statsEntry{
-			name:          name,
-			method:        method,
-			numReqsPerSec: make(map[int64]int64),
-			responseTimes: make(map[int64]int64),
-		}
-		newEntry.reset()
+		newEntry := newStatsEntry(name, method, s.precision)
+		newEntry.cumulativeHistogram = newHistogram(s.precision)
 		s.entries[name+method] = newEntry
 		return newEntry
 	}
@@ -69,11 +138,11 @@ func (s *requestStats) get(name string, method string) (entry *statsEntry) {
 }
 
 func (s *requestStats) clearAll() {
-	s.total = &statsEntry{
-		name:   "Total",
-		method: "",
+	for _, shard := range s.shards {
+		shard.swap()
 	}
-	s.total.reset()
+	s.total = newStatsEntry("Total", "", s.precision)
+	s.total.cumulativeHistogram = newHistogram(s.precision)
 
 	s.entries = make(map[string]*statsEntry)
 	s.errors = make(map[string]*statsError)
@@ -103,14 +172,31 @@ type statsEntry struct {
 	method               string
 	numRequests          int64
 	numFailures          int64
-	totalResponseTime    int64
-	minResponseTime      int64
-	maxResponseTime      int64
+	totalResponseTime    time.Duration
+	minResponseTime      time.Duration
+	maxResponseTime      time.Duration
 	numReqsPerSec        map[int64]int64
-	responseTimes        map[int64]int64
 	totalContentLength   int64
 	startTime            int64
 	lastRequestTimestamp int64
+
+	// histogram holds response times since last report, and is sent to master as response_times,
+	// cumulativeHistogram holds response times since stats are cleared, for local percentiles.
+	// Entries of shards have no cumulativeHistogram.
+	histogram           *histogram
+	cumulativeHistogram *histogram
+	// excludedFromTotal is set for the steps of a SequentialTaskSet in shards.
+	excludedFromTotal bool
+}
+
+func newStatsEntry(name, method string, precision time.Duration) *statsEntry {
+	entry := &statsEntry{
+		name:      name,
+		method:    method,
+		histogram: newHistogram(precision),
+	}
+	entry.reset()
+	return entry
 }
 
 func (s *statsEntry) reset() {
@@ -118,7 +204,7 @@ func (s *statsEntry) reset() {
 	s.numRequests = 0
 	s.numFailures = 0
 	s.totalResponseTime = 0
-	s.responseTimes = make(map[int64]int64)
+	s.histogram.reset()
 	s.minResponseTime = 0
 	s.maxResponseTime = 0
 	s.lastRequestTimestamp = time.Now().Unix()
@@ -126,7 +212,7 @@ func (s *statsEntry) reset() {
 	s.totalContentLength = 0
 }
 
-func (s *statsEntry) log(responseTime int64, contentLength int64) {
+func (s *statsEntry) log(responseTime time.Duration, contentLength int64) {
 	s.numRequests++
 
 	s.logTimeOfRequest()
@@ -148,14 +234,11 @@ func (s *statsEntry) logTimeOfRequest() {
 	s.lastRequestTimestamp = now
 }
 
-func (s *statsEntry) logResponseTime(responseTime int64) {
+func (s *statsEntry) logResponseTime(responseTime time.Duration) {
 	s.totalResponseTime += responseTime
 
-	if s.minResponseTime == 0 {
-		s.minResponseTime = responseTime
-	}
-
-	if responseTime < s.minResponseTime {
+	// 0 is a valid response time, the first request sets the minimum
+	if s.numRequests == 1 || responseTime < s.minResponseTime {
 		s.minResponseTime = responseTime
 	}
 
@@ -163,30 +246,42 @@ func (s *statsEntry) logResponseTime(responseTime int64) {
 		s.maxResponseTime = responseTime
 	}
 
-	roundedResponseTime := int64(0)
+	s.histogram.record(responseTime)
+}
 
-	// to avoid to much data that has to be transferred to the master node when
-	// running in distributed mode, we save the response time rounded in a dict
-	// so that 147 becomes 150, 3432 becomes 3400 and 58760 becomes 59000
-	// see also locust's stats.py
-	if responseTime < 100 {
-		roundedResponseTime = responseTime
-	} else if responseTime < 1000 {
-		roundedResponseTime = int64(round(float64(responseTime), .5, -1))
-	} else if responseTime < 10000 {
-		roundedResponseTime = int64(round(float64(responseTime), .5, -2))
-	} else {
-		roundedResponseTime = int64(round(float64(responseTime), .5, -3))
+// merge adds the requests logged by other, which is an entry of shards.
+func (s *statsEntry) merge(other *statsEntry) {
+	if other.numRequests > 0 {
+		if s.numRequests == 0 || other.minResponseTime < s.minResponseTime {
+			s.minResponseTime = other.minResponseTime
+		}
+		if other.maxResponseTime > s.maxResponseTime {
+			s.maxResponseTime = other.maxResponseTime
+		}
 	}
+	s.numRequests += other.numRequests
+	s.numFailures += other.numFailures
+	s.totalResponseTime += other.totalResponseTime
+	s.totalContentLength += other.totalContentLength
 
-	_, ok := s.responseTimes[roundedResponseTime]
-	if !ok {
-		s.responseTimes[roundedResponseTime] = 1
-	} else {
-		s.responseTimes[roundedResponseTime]++
+	for k, v := range other.numReqsPerSec {
+		s.numReqsPerSec[k] += v
+	}
+	if other.lastRequestTimestamp > s.lastRequestTimestamp {
+		s.lastRequestTimestamp = other.lastRequestTimestamp
+	}
+
+	s.histogram.merge(other.histogram)
+	if s.cumulativeHistogram != nil {
+		s.cumulativeHistogram.merge(other.histogram)
 	}
 }
 
+// percentile returns the response time of percent, counting all the requests since stats are cleared.
+func (s *statsEntry) percentile(percent float64) time.Duration {
+	return s.cumulativeHistogram.percentile(percent)
+}
+
 func (s *statsEntry) logError(err string) {
 	s.numFailures++
 }
@@ -199,12 +294,22 @@ func (s *statsEntry) serialize() map[string]interface{} {
 	result["start_time"] = s.startTime
 	result["num_requests"] = s.numRequests
 	result["num_failures"] = s.numFailures
-	result["total_response_time"] = s.totalResponseTime
-	result["max_response_time"] = s.maxResponseTime
-	result["min_response_time"] = s.minResponseTime
+	// locust records response times in milliseconds, fractions are kept
+	result["total_response_time"] = toMilliseconds(s.totalResponseTime)
+	result["max_response_time"] = toMilliseconds(s.maxResponseTime)
+	result["min_response_time"] = toMilliseconds(s.minResponseTime)
 	result["total_content_length"] = s.totalContentLength
-	result["response_times"] = s.responseTimes
+	// to avoid to much data that has to be transferred to the master node when
+	// running in distributed mode, response times are rounded like locust does
+	result["response_times"] = s.histogram.locustResponseTimes()
 	result["num_reqs_per_sec"] = s.numReqsPerSec
+	if s.cumulativeHistogram != nil {
+		// locust ignores unknown keys, percentiles are for local outputs
+		result["percentiles"] = s.percentiles()
+		// the exact response times since last report are for local outputs only,
+		// they're removed from reports to master
+		result["histogram"] = s.histogram.copy()
+	}
 	return result
 }
 
@@ -214,6 +319,18 @@ func (s *statsEntry) getStrippedReport() map[string]interface{} {
 	return report
 }
 
+// reportedPercentiles are the percentiles in reports, the same as locust's PERCENTILES_TO_REPORT.
+var reportedPercentiles = []float64{50, 66, 75, 80, 90, 95, 98, 99, 99.9, 99.99, 100}
+
+// percentiles returns the reportedPercentiles in nanoseconds, keyed like "p99.9".
+func (s *statsEntry) percentiles() map[string]int64 {
+	result := make(map[string]int64, len(reportedPercentiles))
+	for _, percent := range reportedPercentiles {
+		result[fmt.Sprintf("p%g", percent)] = int64(s.percentile(percent))
+	}
+	return result
+}
+
 type statsError struct {
 	name       string
 	method     string
@@ -236,56 +353,112 @@ func (err *statsError) toMap() map[string]interface{} {
 	return m
 }
 
-func collectReportData() map[string]interface{} {
+func (s *requestStats) collectReportData() map[string]interface{} {
+	s.mergeShards()
+
 	data := make(map[string]interface{})
 
-	data["stats"] = stats.serializeStats()
-	data["stats_total"] = stats.total.getStrippedReport()
-	data["errors"] = stats.serializeErrors()
+	data["stats"] = s.serializeStats()
+	data["stats_total"] = s.total.getStrippedReport()
+	data["errors"] = s.serializeErrors()
 
-	stats.errors = make(map[string]*statsError)
+	s.errors = make(map[string]*statsError)
 
 	return data
 }
 
-type requestSuccess struct {
-	requestType    string
-	name           string
-	responseTime   int64
-	responseLength int64
-}
-
-type requestFailure struct {
-	requestType  string
-	name         string
-	responseTime int64
-	error        string
-}
-
-var stats = newRequestStats()
-var requestSuccessChannel = make(chan *requestSuccess, 100)
-var requestFailureChannel = make(chan *requestFailure, 100)
-var clearStatsChannel = make(chan bool)
-var messageToRunner = make(chan map[string]interface{}, 10)
-
-func init() {
-	stats.entries = make(map[string]*statsEntry)
-	stats.errors = make(map[string]*statsError)
+// start merges shards and reports in a single goroutine, so the aggregation needs no lock.
+func (s *requestStats) start() {
 	go func() {
 		var ticker = time.NewTicker(slaveReportInterval)
+		defer ticker.Stop()
 		for {
 			select {
-			case m := <-requestSuccessChannel:
-				stats.logRequest(m.requestType, m.name, m.responseTime, m.responseLength)
-			case n := <-requestFailureChannel:
-				stats.logError(n.requestType, n.name, n.error)
-			case <-clearStatsChannel:
-				stats.clearAll()
+			case <-s.clearStatsChannel:
+				s.clearAll()
+			case reply := <-s.flushChannel:
+				reply <- s.collectReportData()
 			case <-ticker.C:
-				data := collectReportData()
+				data := s.collectReportData()
 				// send data to channel, no network IO in this goroutine
-				messageToRunner <- data
+				s.messageToRunner <- data
+			case <-s.shutdownChannel:
+				return
 			}
 		}
 	}()
 }
+
+// flush returns a report of the requests since last report without waiting for the ticker,
+// it returns nil after close.
+func (s *requestStats) flush() map[string]interface{} {
+	reply := make(chan map[string]interface{}, 1)
+	select {
+	case s.flushChannel <- reply:
+		return <-reply
+	case <-s.shutdownChannel:
+		return nil
+	}
+}
+
+func (s *requestStats) close() {
+	close(s.shutdownChannel)
+}
+
+// statsShard holds the requests logged since last report by some of the users.
+type statsShard struct {
+	mutex     sync.Mutex
+	precision time.Duration
+	entries   map[string]*statsEntry
+	// errors are keyed by errorKey, MD5 is too slow to be computed for every failure
+	errors map[errorKey]*statsError
+}
+
+type errorKey struct {
+	method string
+	name   string
+	error  string
+}
+
+func newStatsShard(precision time.Duration) *statsShard {
+	return &statsShard{
+		precision: precision,
+		entries:   make(map[string]*statsEntry),
+		errors:    make(map[errorKey]*statsError),
+	}
+}
+
+// get and logError must be called with mutex locked.
+
+func (s *statsShard) get(name string, method string) *statsEntry {
+	entry, ok := s.entries[name+method]
+	if !ok {
+		entry = newStatsEntry(name, method, s.precision)
+		s.entries[name+method] = entry
+	}
+	return entry
+}
+
+func (s *statsShard) logError(method, name, err string) {
+	key := errorKey{method, name, err}
+	entry, ok := s.errors[key]
+	if !ok {
+		entry = &statsError{
+			name:   name,
+			method: method,
+			error:  err,
+		}
+		s.errors[key] = entry
+	}
+	entry.occured()
+}
+
+// swap takes away what has been logged.
+func (s *statsShard) swap() (entries map[string]*statsEntry, errors map[errorKey]*statsError) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entries, errors = s.entries, s.errors
+	s.entries = make(map[string]*statsEntry)
+	s.errors = make(map[errorKey]*statsError)
+	return entries, errors
+}
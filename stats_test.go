@@ -0,0 +1,84 @@
+package boomer
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSubMillisecondResponseTimes(t *testing.T) {
+	stats := newRequestStats(time.Microsecond)
+	stats.logRequest("rpc", "get", 0, 1)
+	stats.logRequest("rpc", "get", 250*time.Microsecond, 1)
+	stats.logRequest("rpc", "get", 1500*time.Microsecond, 1)
+	stats.mergeShards()
+
+	entry := stats.get("get", "rpc")
+	if entry.minResponseTime != 0 || entry.maxResponseTime != 1500*time.Microsecond {
+		t.Error("wrong min or max response time", entry.minResponseTime, entry.maxResponseTime)
+	}
+	if p := entry.percentile(50); p < 250*time.Microsecond || p > 260*time.Microsecond {
+		t.Error("wrong median", p)
+	}
+
+	report := entry.serialize()
+	if report["total_response_time"] != 1.75 || report["min_response_time"] != 0.0 || report["max_response_time"] != 1.5 {
+		t.Error("response times should be sent in milliseconds", report)
+	}
+}
+
+func TestShardsAreMerged(t *testing.T) {
+	stats := newRequestStats(time.Microsecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				stats.logRequest("rpc", "get", time.Millisecond, 1)
+				stats.logError("rpc", "get", "timeout")
+			}
+		}()
+	}
+	wg.Wait()
+
+	data := stats.collectReportData()
+	total := data["stats_total"].(map[string]interface{})
+	if total["num_requests"] != int64(1000) || total["num_failures"] != int64(1000) {
+		t.Error("wrong total", total["num_requests"], total["num_failures"])
+	}
+	errors := data["errors"].(map[string]map[string]interface{})
+	if errors[MD5("rpc", "get", "timeout")]["occurences"] != int64(1000) {
+		t.Error("wrong errors", errors)
+	}
+	if stats.total.percentile(99) < time.Millisecond {
+		t.Error("percentiles should be kept after report", stats.total.percentile(99))
+	}
+}
+
+func BenchmarkLogRequest(b *testing.B) {
+	stats := newRequestStats(time.Microsecond)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			stats.logRequest("rpc", "get", time.Millisecond, 1)
+		}
+	})
+}
+
+func BenchmarkLogError(b *testing.B) {
+	stats := newRequestStats(time.Microsecond)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			stats.logError("rpc", "get", "timeout")
+		}
+	})
+}
+
+func BenchmarkRecordSuccess(b *testing.B) {
+	boomer := newIdleBoomer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			boomer.RecordSuccess("rpc", "get", time.Millisecond, 1)
+		}
+	})
+}
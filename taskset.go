@@ -0,0 +1,188 @@
+package boomer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// TaskSet is like locust's TaskSet, it holds weighted tasks and nested task sets.
+// Every iteration, a user picks one of them by weight, and when it picks a nested task set,
+// the user keeps picking in it until a task calls InterruptTaskSet.
+//
+// Pass AsTask to Run, every goroutine has its own position in the hierarchy.
+// NewUser of tasks and nested task sets are ignored, the user of the root task set is
+// given to FnUser of all the tasks.
+type TaskSet struct {
+	Name     string
+	Weight   int
+	Tasks    []*Task
+	TaskSets []*TaskSet
+	// WaitTime is how long a user waits after every iteration, WaitTime of tasks in the set are ignored.
+	WaitTime WaitTime
+	// NewUser creates a User for every goroutine if it's set.
+	NewUser func() User
+}
+
+// AsTask returns a Task that runs a task of the set every iteration.
+// Run returns an error if neither the set nor its nested task sets have tasks.
+func (ts *TaskSet) AsTask() *Task {
+	return &Task{
+		Name:     ts.Name,
+		Weight:   ts.Weight,
+		WaitTime: ts.WaitTime,
+		NewUser: func() User {
+			return newTaskSetUser(ts)
+		},
+		FnUser: func(ctx context.Context, user User) {
+			if err := user.(*taskSetUser).run(ctx); err != nil {
+				log.Println(err)
+			}
+		},
+		taskSet: ts,
+	}
+}
+
+// hasTasks returns true if the set or one of its nested task sets has a task.
+func (ts *TaskSet) hasTasks() bool {
+	if len(ts.Tasks) > 0 {
+		return true
+	}
+	for _, child := range ts.TaskSets {
+		if child.hasTasks() {
+			return true
+		}
+	}
+	return false
+}
+
+// children returns the nested task sets that have tasks, the empty ones are never picked.
+func (ts *TaskSet) children() []*TaskSet {
+	children := make([]*TaskSet, 0, len(ts.TaskSets))
+	for _, child := range ts.TaskSets {
+		if child.hasTasks() {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// pick returns a task or a nested task set by weight, they are equally likely if there are no weights.
+func (ts *TaskSet) pick(random *rand.Rand) (*Task, *TaskSet) {
+	children := ts.children()
+	count := len(ts.Tasks) + len(children)
+	if count == 0 {
+		return nil, nil
+	}
+	sum := 0
+	for _, task := range ts.Tasks {
+		sum += task.Weight
+	}
+	for _, child := range children {
+		sum += child.Weight
+	}
+	if sum <= 0 {
+		i := random.Intn(count)
+		if i < len(ts.Tasks) {
+			return ts.Tasks[i], nil
+		}
+		return nil, children[i-len(ts.Tasks)]
+	}
+	n := random.Intn(sum)
+	for _, task := range ts.Tasks {
+		if n < task.Weight {
+			return task, nil
+		}
+		n -= task.Weight
+	}
+	for _, child := range children {
+		if n < child.Weight {
+			return nil, child
+		}
+		n -= child.Weight
+	}
+	return nil, nil
+}
+
+type taskSetContextKey struct{}
+
+// taskSetInterrupt is set by InterruptTaskSet during a task.
+type taskSetInterrupt struct {
+	interrupted bool
+}
+
+// taskSetUser is the position of a goroutine in a task set, it wraps the user of the root task set.
+type taskSetUser struct {
+	user      User
+	stack     []*TaskSet
+	interrupt taskSetInterrupt
+	random    *rand.Rand
+}
+
+func newTaskSetUser(ts *TaskSet) *taskSetUser {
+	u := &taskSetUser{
+		stack:  []*TaskSet{ts},
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if ts.NewUser != nil {
+		u.user = ts.NewUser()
+	}
+	return u
+}
+
+// OnStart implements User.
+func (u *taskSetUser) OnStart(ctx context.Context) {
+	if u.user != nil {
+		u.user.OnStart(ctx)
+	}
+}
+
+// OnStop implements User.
+func (u *taskSetUser) OnStop() {
+	if u.user != nil {
+		u.user.OnStop()
+	}
+}
+
+// run descends into nested task sets until it picks a task, and runs it.
+// It returns an error if there are no tasks at all.
+func (u *taskSetUser) run(ctx context.Context) error {
+	var task *Task
+	for task == nil {
+		select {
+		case <-ctx.Done():
+			// users are stopped
+			return nil
+		default:
+		}
+		current := u.stack[len(u.stack)-1]
+		picked, child := current.pick(u.random)
+		switch {
+		case picked != nil:
+			task = picked
+		case child != nil:
+			u.stack = append(u.stack, child)
+		default:
+			return fmt.Errorf("task set %s has no tasks", u.stack[0].Name)
+		}
+	}
+
+	u.interrupt.interrupted = false
+	task.run(context.WithValue(ctx, taskSetContextKey{}, &u.interrupt), u.user)
+	if u.interrupt.interrupted && len(u.stack) > 1 {
+		u.stack = u.stack[:len(u.stack)-1]
+	}
+	return nil
+}
+
+// InterruptTaskSet makes the user return to the parent task set after the running task,
+// like locust's TaskSet.interrupt, and ends the journey of a SequentialTaskSet.
+// ctx is the one given to FnCtx or FnUser of a task in a task set,
+// it does nothing in the root TaskSet or outside task sets.
+func InterruptTaskSet(ctx context.Context) {
+	if interrupt, ok := ctx.Value(taskSetContextKey{}).(*taskSetInterrupt); ok {
+		interrupt.interrupted = true
+	}
+}
@@ -0,0 +1,138 @@
+package boomer
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestTaskSetPick(t *testing.T) {
+	foo := &Task{Name: "foo", Weight: 1}
+	bar := &Task{Name: "bar", Weight: 3}
+	child := &TaskSet{Name: "child", Weight: 4, Tasks: []*Task{{Name: "baz", Weight: 1}}}
+	ts := &TaskSet{Tasks: []*Task{foo, bar}, TaskSets: []*TaskSet{child}}
+
+	random := rand.New(rand.NewSource(1))
+	counts := make(map[string]int)
+	for i := 0; i < 8000; i++ {
+		task, set := ts.pick(random)
+		if task != nil {
+			counts[task.Name]++
+		} else {
+			counts[set.Name]++
+		}
+	}
+	for name, expected := range map[string]int{"foo": 1000, "bar": 3000, "child": 4000} {
+		if counts[name] < expected*9/10 || counts[name] > expected*11/10 {
+			t.Errorf("%s should be picked about %d times, got %d", name, expected, counts[name])
+		}
+	}
+
+	if task, set := (&TaskSet{}).pick(random); task != nil || set != nil {
+		t.Error("nothing should be picked in an empty task set")
+	}
+}
+
+func TestNestedTaskSet(t *testing.T) {
+	var runs []string
+	record := func(name string, interrupt bool) *Task {
+		return &Task{Name: name, Weight: 1, FnCtx: func(ctx context.Context) {
+			runs = append(runs, name)
+			if interrupt {
+				InterruptTaskSet(ctx)
+			}
+		}}
+	}
+	child := &TaskSet{Name: "child", Weight: 1, Tasks: []*Task{record("leave", true)}}
+	root := &TaskSet{Name: "root", Weight: 1, Tasks: []*Task{record("stay", false)}, TaskSets: []*TaskSet{child}}
+
+	task := root.AsTask()
+	user := task.newUser()
+	u := user.(*taskSetUser)
+	for i := 0; i < 100; i++ {
+		task.run(context.Background(), user)
+		if len(u.stack) != 1 {
+			t.Fatal("the user should return to the root after it's interrupted")
+		}
+	}
+	counts := make(map[string]int)
+	for _, name := range runs {
+		counts[name]++
+	}
+	if counts["stay"] == 0 || counts["leave"] == 0 || len(runs) != 100 {
+		t.Error("tasks of both task sets should run, got", counts)
+	}
+
+	// interrupting the root does nothing
+	InterruptTaskSet(context.Background())
+}
+
+type rootUser struct {
+	started, stopped bool
+}
+
+func (u *rootUser) OnStart(ctx context.Context) { u.started = true }
+
+func (u *rootUser) OnStop() { u.stopped = true }
+
+func TestTaskSetUser(t *testing.T) {
+	var got User
+	ts := &TaskSet{
+		NewUser: func() User { return &rootUser{} },
+		Tasks: []*Task{{Weight: 1, FnUser: func(ctx context.Context, user User) {
+			got = user
+		}}},
+	}
+	task := ts.AsTask()
+	user := task.newUser()
+	user.OnStart(context.Background())
+	task.run(context.Background(), user)
+	user.OnStop()
+
+	root, ok := got.(*rootUser)
+	if !ok {
+		t.Fatal("tasks should get the user of the root task set, got", got)
+	}
+	if !root.started || !root.stopped {
+		t.Error("the user of the root task set should be started and stopped")
+	}
+}
+
+func TestEmptyTaskSet(t *testing.T) {
+	var ran int
+	ts := &TaskSet{
+		TaskSets: []*TaskSet{{}},
+		Tasks:    []*Task{{Fn: func() { ran++ }}},
+	}
+	user := newTaskSetUser(ts)
+	for i := 0; i < 10; i++ {
+		if err := user.run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ran != 10 {
+		t.Error("the empty nested task set shouldn't be picked, tasks ran", ran)
+	}
+
+	// a nested empty task set used to spin forever
+	empty := &TaskSet{Name: "empty", TaskSets: []*TaskSet{{}}}
+	done := make(chan error)
+	go func() { done <- newTaskSetUser(empty).run(context.Background()) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("a task set without tasks should return an error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a task set without tasks should return")
+	}
+
+	config := DefaultConfig()
+	config.Standalone = true
+	b := New(config)
+	defer b.stats.close()
+	if err := b.Run(empty.AsTask()); err == nil {
+		t.Error("Run should reject a task set without tasks")
+	}
+}
@@ -0,0 +1,276 @@
+package boomer
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// thresholdOperators are matched in order, so "<=" is never taken as "<".
+var thresholdOperators = []string{"<=", ">=", "<", ">"}
+
+// threshold is a condition on the stats of an entry, like "http/200: p99 < 250ms".
+// Without METHOD/NAME, it's checked against the total.
+type threshold struct {
+	expr     string
+	method   string
+	name     string
+	metric   string
+	operator string
+	value    float64
+}
+
+// parseThreshold parses "[METHOD/NAME:] METRIC OPERATOR VALUE".
+//
+// Metrics are avg, min, max and percentiles like p99 in milliseconds, a unit like 250ms or 1s can be given,
+// failure_ratio as a fraction or a percentage like 1%, rps and fps per second, requests and failures.
+func parseThreshold(expr string) (*threshold, error) {
+	t := &threshold{expr: strings.TrimSpace(expr)}
+	condition := t.expr
+	// names may contain colons, conditions never do
+	if i := strings.LastIndex(condition, ":"); i >= 0 {
+		target := strings.TrimSpace(condition[:i])
+		condition = condition[i+1:]
+		if target != "Total" {
+			j := strings.Index(target, "/")
+			if j <= 0 || j == len(target)-1 {
+				return nil, fmt.Errorf("invalid threshold %q, the entry should be METHOD/NAME", expr)
+			}
+			t.method, t.name = target[:j], target[j+1:]
+		}
+	}
+
+	for _, operator := range thresholdOperators {
+		if i := strings.Index(condition, operator); i >= 0 {
+			t.metric = strings.TrimSpace(condition[:i])
+			t.operator = operator
+			value, err := parseThresholdValue(t.metric, strings.TrimSpace(condition[i+len(operator):]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid threshold %q, %v", expr, err)
+			}
+			t.value = value
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid threshold %q, the operator should be one of %v", expr, thresholdOperators)
+}
+
+func parseThresholdValue(metric, value string) (float64, error) {
+	switch {
+	case isResponseTimeMetric(metric):
+		if d, err := time.ParseDuration(value); err == nil {
+			return toMilliseconds(d), nil
+		}
+		return strconv.ParseFloat(value, 64)
+	case metric == "failure_ratio":
+		if strings.HasSuffix(value, "%") {
+			percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+			return percent / 100, err
+		}
+		return strconv.ParseFloat(value, 64)
+	case metric == "rps", metric == "fps", metric == "requests", metric == "failures":
+		return strconv.ParseFloat(value, 64)
+	}
+	return 0, fmt.Errorf("unknown metric %q", metric)
+}
+
+func isResponseTimeMetric(metric string) bool {
+	switch metric {
+	case "avg", "min", "max":
+		return true
+	}
+	if !strings.HasPrefix(metric, "p") {
+		return false
+	}
+	// only the reported percentiles are known
+	for _, percent := range reportedPercentiles {
+		if metric == fmt.Sprintf("p%g", percent) {
+			return true
+		}
+	}
+	return false
+}
+
+// actual returns the value of the metric since users start hatching.
+func (t *threshold) actual(entries *outputEntries) float64 {
+	e := entries.total
+	if t.name != "" {
+		var ok bool
+		if e, ok = entries.entries[t.name+t.method]; !ok {
+			e = newOutputEntry(t.method, t.name)
+		}
+	}
+	switch t.metric {
+	case "avg":
+		return e.avgResponseTime()
+	case "min":
+		return e.minResponseTime
+	case "max":
+		return e.maxResponseTime
+	case "failure_ratio":
+		if e.numRequests+e.numFailures == 0 {
+			return 0
+		}
+		return float64(e.numFailures) / float64(e.numRequests+e.numFailures)
+	case "rps":
+		return float64(e.numRequests) / entries.elapsed()
+	case "fps":
+		return float64(e.numFailures) / entries.elapsed()
+	case "requests":
+		return float64(e.numRequests)
+	case "failures":
+		return float64(e.numFailures)
+	}
+	percent, _ := strconv.ParseFloat(strings.TrimPrefix(t.metric, "p"), 64)
+	return e.percentile(percent)
+}
+
+func (t *threshold) check(actual float64) bool {
+	switch t.operator {
+	case "<":
+		return actual < t.value
+	case "<=":
+		return actual <= t.value
+	case ">":
+		return actual > t.value
+	}
+	return actual >= t.value
+}
+
+// maximum tells whether the threshold is an upper limit, which can be broken before users are stopped.
+// Lower limits like "rps > 500" are never met during ramp-up, so they're only checked when users are stopped.
+func (t *threshold) maximum() bool {
+	return t.operator == "<" || t.operator == "<="
+}
+
+func (t *threshold) format(value float64) string {
+	switch {
+	case isResponseTimeMetric(t.metric):
+		return fmt.Sprintf("%.2fms", value)
+	case t.metric == "failure_ratio":
+		return fmt.Sprintf("%.2f%%", value*100)
+	}
+	return fmt.Sprintf("%.2f", value)
+}
+
+// thresholdOutput checks thresholds when users are stopped, and upper limits at every report if it's continuous.
+type thresholdOutput struct {
+	thresholds []*threshold
+	continuous bool
+
+	mutex   sync.Mutex
+	entries *outputEntries
+	// broken holds the summaries of broken thresholds
+	broken map[*threshold]string
+	// brokenChannel receives when a threshold breaks during a continuous check, it's drained when
+	// users start hatching again, so the channel stays the same for whoever waits on it.
+	brokenChannel chan struct{}
+}
+
+func newThresholdOutput(exprs []string, continuous bool) (*thresholdOutput, error) {
+	o := &thresholdOutput{
+		continuous:    continuous,
+		entries:       newOutputEntries(),
+		broken:        make(map[*threshold]string),
+		brokenChannel: make(chan struct{}, 1),
+	}
+	for _, expr := range exprs {
+		t, err := parseThreshold(expr)
+		if err != nil {
+			return nil, err
+		}
+		o.thresholds = append(o.thresholds, t)
+	}
+	return o, nil
+}
+
+// OnStart implements Output.
+func (o *thresholdOutput) OnStart() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.entries = newOutputEntries()
+	o.broken = make(map[*threshold]string)
+	select {
+	case <-o.brokenChannel:
+	default:
+	}
+}
+
+// OnEvent implements Output.
+func (o *thresholdOutput) OnEvent(data map[string]interface{}) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.entries.extend(data)
+	if !o.continuous {
+		return
+	}
+	for _, t := range o.thresholds {
+		if _, ok := o.broken[t]; ok || !t.maximum() {
+			continue
+		}
+		if actual := t.actual(o.entries); !t.check(actual) {
+			o.broken[t] = fmt.Sprintf("%s, actual %s", t.expr, t.format(actual))
+			log.Println("Threshold broken:", o.broken[t])
+			select {
+			case o.brokenChannel <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// OnStop implements Output.
+func (o *thresholdOutput) OnStop() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	log.Println("Thresholds:")
+	for _, t := range o.thresholds {
+		actual := t.actual(o.entries)
+		summary := fmt.Sprintf("%s, actual %s", t.expr, t.format(actual))
+		if !t.check(actual) {
+			o.broken[t] = summary
+		}
+		// a threshold broken during the test stays broken
+		if broken, ok := o.broken[t]; ok {
+			log.Println("  FAIL", broken)
+		} else {
+			log.Println("  PASS", summary)
+		}
+	}
+}
+
+// brokenThresholds returns the summaries of broken thresholds, in the order they're given.
+func (o *thresholdOutput) brokenThresholds() []string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	var broken []string
+	for _, t := range o.thresholds {
+		if summary, ok := o.broken[t]; ok {
+			broken = append(broken, summary)
+		}
+	}
+	return broken
+}
+
+// thresholdsFlag collects the values of a repeated flag.
+type thresholdsFlag struct {
+	thresholds *[]string
+}
+
+func (f thresholdsFlag) String() string {
+	if f.thresholds == nil {
+		return ""
+	}
+	return strings.Join(*f.thresholds, ", ")
+}
+
+func (f thresholdsFlag) Set(value string) error {
+	if _, err := parseThreshold(value); err != nil {
+		return err
+	}
+	*f.thresholds = append(*f.thresholds, value)
+	return nil
+}
@@ -0,0 +1,123 @@
+package boomer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseThreshold(t *testing.T) {
+	for expr, expected := range map[string]threshold{
+		"http/200: p99 < 250ms":     {method: "http", name: "200", metric: "p99", operator: "<", value: 250},
+		"GET/http://a/b:avg<=1s":    {method: "GET", name: "http://a/b", metric: "avg", operator: "<=", value: 1000},
+		"failure_ratio < 1%":        {metric: "failure_ratio", operator: "<", value: 0.01},
+		"Total: failure_ratio<0.05": {metric: "failure_ratio", operator: "<", value: 0.05},
+		"rps > 500":                 {metric: "rps", operator: ">", value: 500},
+		"p99.9 >= 10":               {metric: "p99.9", operator: ">=", value: 10},
+	} {
+		threshold, err := parseThreshold(expr)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		expected.expr = expr
+		if *threshold != expected {
+			t.Errorf("%q is parsed as %+v, expected %+v", expr, *threshold, expected)
+		}
+	}
+
+	for _, expr := range []string{"p42 < 1", "latency < 1", "rps = 1", "http: rps > 1", "rps > fast"} {
+		if _, err := parseThreshold(expr); err == nil {
+			t.Errorf("%q should be invalid", expr)
+		}
+	}
+}
+
+func TestThresholdOutput(t *testing.T) {
+	o, err := newThresholdOutput([]string{
+		"http/foo: max < 50ms",
+		"http/foo: avg > 25ms",
+		"failure_ratio < 10%",
+		"http/missing: requests >= 0",
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestReport(o)
+
+	broken := o.brokenThresholds()
+	if len(broken) != 2 {
+		t.Fatal("2 thresholds should be broken, got", broken)
+	}
+	if broken[0] != "http/foo: avg > 25ms, actual 20.00ms" {
+		t.Error("unexpected summary", broken[0])
+	}
+	if !strings.HasPrefix(broken[1], "failure_ratio < 10%, actual 33.33%") {
+		t.Error("unexpected summary", broken[1])
+	}
+	select {
+	case <-o.brokenChannel:
+	default:
+		t.Error("continuous check should have found the broken thresholds")
+	}
+}
+
+func TestContinuousThresholds(t *testing.T) {
+	o, err := newThresholdOutput([]string{"requests > 5", "max < 50ms"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := newRequestStats(time.Microsecond)
+	broken := func() bool {
+		select {
+		case <-o.brokenChannel:
+			return true
+		default:
+			return false
+		}
+	}
+
+	o.OnStart()
+	stats.logRequest("http", "foo", 10*time.Millisecond, 100)
+	o.OnEvent(stats.collectReportData())
+	if broken() {
+		t.Error("lower limits shouldn't break during ramp-up")
+	}
+	stats.logRequest("http", "foo", 100*time.Millisecond, 100)
+	o.OnEvent(stats.collectReportData())
+	if !broken() {
+		t.Error("max should be broken")
+	}
+
+	// hatching again starts over
+	o.OnStart()
+	if broken() || len(o.brokenThresholds()) != 0 {
+		t.Error("thresholds broken before hatching again should be forgotten")
+	}
+	stats.logRequest("http", "foo", 100*time.Millisecond, 100)
+	o.OnEvent(stats.collectReportData())
+	if !broken() {
+		t.Error("max should be broken again")
+	}
+}
+
+func TestThresholdsAreCheckedWhenStopped(t *testing.T) {
+	o, err := newThresholdOutput([]string{"requests > 1"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.OnStart()
+	stats := newRequestStats(time.Microsecond)
+	stats.logRequest("http", "foo", 10*time.Millisecond, 100)
+	o.OnEvent(stats.collectReportData())
+
+	select {
+	case <-o.brokenChannel:
+		t.Error("thresholds aren't checked continuously")
+	default:
+	}
+	o.OnStop()
+	if broken := o.brokenThresholds(); len(broken) != 1 {
+		t.Error("the threshold should be broken when stopped, got", broken)
+	}
+}
@@ -0,0 +1,21 @@
+package boomer
+
+import "context"
+
+// User is a simulated user like locust's User, every goroutine of a Task has its own one,
+// so it can hold a session, like a cookie jar or a connection.
+type User interface {
+	// OnStart is called before the user runs the task, like logging in.
+	OnStart(ctx context.Context)
+
+	// OnStop is called when the user is stopped, after the task returns.
+	OnStop()
+}
+
+// newUser returns nil if the task has no users.
+func (task *Task) newUser() User {
+	if task.NewUser == nil {
+		return nil
+	}
+	return task.NewUser()
+}
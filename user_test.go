@@ -0,0 +1,68 @@
+package boomer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type sessionUser struct {
+	started    int64
+	iterations int64
+	stopped    int64
+}
+
+func (u *sessionUser) OnStart(ctx context.Context) { atomic.AddInt64(&u.started, 1) }
+
+func (u *sessionUser) OnStop() { atomic.AddInt64(&u.stopped, 1) }
+
+func TestUsers(t *testing.T) {
+	stats := newRequestStats(time.Microsecond)
+	stats.start()
+	defer stats.close()
+	config := DefaultConfig()
+	config.HeartbeatInterval = 0
+
+	var mutex sync.Mutex
+	var users []*sessionUser
+	task := &Task{
+		Name:   "session",
+		Weight: 1,
+		NewUser: func() User {
+			mutex.Lock()
+			defer mutex.Unlock()
+			u := &sessionUser{}
+			users = append(users, u)
+			return u
+		},
+		FnUser: func(ctx context.Context, user User) {
+			u := user.(*sessionUser)
+			if atomic.LoadInt64(&u.started) != 1 {
+				t.Error("the user should be started before running the task")
+			}
+			atomic.AddInt64(&u.iterations, 1)
+			time.Sleep(time.Millisecond)
+		},
+	}
+	r := newRunner([]*Task{task}, stats, config)
+	r.getReady()
+	defer r.close()
+
+	r.startHatching(3, 10)
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&r.numClients) == 3 })
+	time.Sleep(10 * time.Millisecond)
+	r.stop()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(users) != 3 {
+		t.Fatal("every goroutine should have its own user, got", len(users))
+	}
+	for _, u := range users {
+		if u.started != 1 || u.stopped != 1 || u.iterations == 0 {
+			t.Errorf("user should be started and stopped once, got %+v", *u)
+		}
+	}
+}
@@ -42,7 +42,13 @@ func getNodeID() (nodeID string) {
 	return
 }
 
+// toMilliseconds converts d to milliseconds for locust, without losing the fraction.
+func toMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
 // Now gets current timestamp in milliseconds.
+// Use time.Now and time.Since to measure response times in higher precision.
 func Now() int64 {
 	return time.Now().UnixNano() / int64(time.Millisecond)
 }
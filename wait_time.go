@@ -0,0 +1,46 @@
+package boomer
+
+import (
+	"math/rand"
+	"time"
+)
+
+// WaitTime returns how long a user waits after an iteration, like locust's wait_time.
+// elapsed is how long the iteration takes.
+type WaitTime func(elapsed time.Duration) time.Duration
+
+// Constant waits for the same time after every iteration.
+func Constant(wait time.Duration) WaitTime {
+	return func(elapsed time.Duration) time.Duration {
+		return wait
+	}
+}
+
+// Between waits for a random time between min and max, like locust's between.
+func Between(min, max time.Duration) WaitTime {
+	if max <= min {
+		return Constant(min)
+	}
+	return func(elapsed time.Duration) time.Duration {
+		return min + time.Duration(rand.Int63n(int64(max-min)+1))
+	}
+}
+
+// Exponential waits for a random time of an exponential distribution with the mean,
+// so iterations of a user arrive like a poisson process.
+func Exponential(mean time.Duration) WaitTime {
+	return func(elapsed time.Duration) time.Duration {
+		return time.Duration(rand.ExpFloat64() * float64(mean))
+	}
+}
+
+// ConstantPacing starts an iteration every interval, the time of the iteration is compensated,
+// like locust's constant_pacing. It doesn't wait if the iteration takes longer than the interval.
+func ConstantPacing(interval time.Duration) WaitTime {
+	return func(elapsed time.Duration) time.Duration {
+		if elapsed >= interval {
+			return 0
+		}
+		return interval - elapsed
+	}
+}
@@ -0,0 +1,66 @@
+package boomer
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitTime(t *testing.T) {
+	if wait := Constant(time.Second)(time.Hour); wait != time.Second {
+		t.Error("constant should wait for 1s, got", wait)
+	}
+
+	between := Between(10*time.Millisecond, 20*time.Millisecond)
+	for i := 0; i < 1000; i++ {
+		if wait := between(0); wait < 10*time.Millisecond || wait > 20*time.Millisecond {
+			t.Fatal("between should wait for 10ms to 20ms, got", wait)
+		}
+	}
+	if wait := Between(time.Second, time.Second)(0); wait != time.Second {
+		t.Error("between the same times should wait for it, got", wait)
+	}
+
+	exponential := Exponential(10 * time.Millisecond)
+	var total time.Duration
+	for i := 0; i < 10000; i++ {
+		total += exponential(0)
+	}
+	if mean := total / 10000; mean < 9*time.Millisecond || mean > 11*time.Millisecond {
+		t.Error("the mean of exponential should be about 10ms, got", mean)
+	}
+
+	pacing := ConstantPacing(time.Second)
+	if wait := pacing(300 * time.Millisecond); wait != 700*time.Millisecond {
+		t.Error("constant pacing should compensate the iteration, got", wait)
+	}
+	if wait := pacing(2 * time.Second); wait != 0 {
+		t.Error("constant pacing shouldn't wait after a long iteration, got", wait)
+	}
+}
+
+func TestWaitIsInterruptedByStop(t *testing.T) {
+	stats := newRequestStats(time.Microsecond)
+	stats.start()
+	defer stats.close()
+	config := DefaultConfig()
+	config.HeartbeatInterval = 0
+	var iterations int64
+	task := &Task{Name: "foo", Weight: 1, WaitTime: Constant(time.Hour), Fn: func() {
+		atomic.AddInt64(&iterations, 1)
+	}}
+	r := newRunner([]*Task{task}, stats, config)
+	r.getReady()
+	defer r.close()
+
+	r.startHatching(2, 10)
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt64(&iterations) == 2 })
+	start := time.Now()
+	r.stop()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("stop should interrupt waiting users, it takes", elapsed)
+	}
+	if n := atomic.LoadInt64(&iterations); n != 2 {
+		t.Error("users should wait after every iteration, got", n)
+	}
+}